@@ -1,42 +1,156 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/cpcf/meh/internal/client"
+	"github.com/cpcf/meh/pkg/meh"
 )
 
 func main() {
 	opts := parseFlags()
 
+	if flag.NArg() > 0 && client.IsCommand(flag.Arg(0)) && !afterSeparator() {
+		opts.Command = flag.Args()
+		run(opts)
+		return
+	}
+
 	// Build a final query from CLI arguments prepended to any piped input.
-	finalQuery := buildQuery(flag.Args(), readStdin())
+	// In interactive mode piped input is left for the conversation to read.
+	stdin := ""
+	if !opts.Interactive {
+		stdin = readStdin()
+	}
+	finalQuery := buildQuery(flag.Args(), stdin)
 	if finalQuery != "" {
 		opts.QueryArgs = []string{finalQuery}
 	}
 
-	if err := client.RunApp(opts); err != nil {
+	run(opts)
+}
+
+// run runs the app, exiting non-zero if it fails.
+func run(opts client.Options) {
+	err := client.RunApp(opts)
+	var usage client.UsageError
+	if errors.As(err, &usage) {
+		fmt.Fprintln(os.Stderr, usage)
+		if len(opts.Command) > 0 {
+			fmt.Fprintf(os.Stderr, "\nTo send a query starting with %q, use: meh -- %s\n", opts.Command[0], strings.Join(opts.Command, " "))
+		}
+		os.Exit(2)
+	}
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "interrupted")
+		os.Exit(130)
+	}
+	if err != nil {
 		log.Fatalf("Application error: %v", err)
 	}
 }
 
 func parseFlags() client.Options {
-	filePath := flag.String("f", "", "Read input from a file")
 	configFlag := flag.Bool("c", false, "Edit config settings")
 	personaFlag := flag.String("p", "", "Select a persona")
 	helpFlag := flag.Bool("h", false, "Print usage instructions")
+	continueFlag := flag.Bool("continue", false, "Resume the most recent session")
+	sessionFlag := flag.String("s", "", "Resume a session by name or ID")
+	interactiveFlag := flag.Bool("i", false, "Chat on the command line without the TUI")
+	formatFlag := flag.String("format", "", "Constrain the response to a format (json)")
+	schemaFlag := flag.String("schema", "", "Constrain the response to a JSON schema file")
+	rawFlag := flag.Bool("raw", false, "Print responses as raw markdown instead of rendering them")
+	codeFlag := flag.Bool("code", false, "Print only the code blocks of the response")
+	statsFlag := flag.Bool("stats", false, "Print token counts and speed to stderr after each response")
+	templateFlag := flag.String("t", "", "Fill in a prompt template with the query")
+	vars := varsFlag{}
+	flag.Var(vars, "var", "Set a template variable as name=value (repeatable)")
+	var files stringsFlag
+	flag.Var(&files, "f", "Add a file, glob or directory to the query (repeatable)")
+	budgetFlag := flag.Int("budget", 0, "Token budget for -f files (default 3/4 of num_ctx)")
+	indexFlag := flag.String("r", "", "Answer from the passages of an index found relevant to the query")
+	chunksFlag := flag.Int("chunks", 0, "Number of passages -r adds to the query (default 4)")
+	var images stringsFlag
+	flag.Var(&images, "img", "Attach a PNG or JPEG image (repeatable)")
+	modelOptions := meh.Options{}
+	client.OptionFlags(flag.CommandLine, modelOptions, "Override the persona's %s option")
 	flag.Parse()
 
+	schema := *schemaFlag
+	if schema != "" {
+		if abs, err := filepath.Abs(schema); err == nil {
+			schema = abs
+		}
+	}
+
 	return client.Options{
-		FilePath: *filePath,
-		Config:   *configFlag,
-		Persona:  *personaFlag,
-		Help:     *helpFlag,
+		FilePaths:    files,
+		Budget:       *budgetFlag,
+		Config:       *configFlag,
+		Persona:      *personaFlag,
+		Help:         *helpFlag,
+		Continue:     *continueFlag,
+		Session:      *sessionFlag,
+		Interactive:  *interactiveFlag,
+		Images:       images,
+		Format:       *formatFlag,
+		Schema:       schema,
+		ModelOptions: modelOptions,
+		Raw:          *rawFlag,
+		Code:         *codeFlag,
+		Stats:        *statsFlag,
+		Template:     *templateFlag,
+		Variables:    vars,
+		Index:        *indexFlag,
+		Chunks:       *chunksFlag,
+	}
+}
+
+// afterSeparator reports whether the arguments left after the flags followed
+// a "--", which makes them a query even if the first names a subcommand.
+func afterSeparator() bool {
+	i := len(os.Args) - flag.NArg() - 1
+	return i > 0 && os.Args[i] == "--"
+}
+
+// stringsFlag is a flag.Value collecting every use of a repeatable flag.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *stringsFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// varsFlag is a flag.Value collecting name=value pairs.
+type varsFlag map[string]string
+
+func (f varsFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func (f varsFlag) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=value")
 	}
+	f[name] = value
+	return nil
 }
 
 // readStdin returns trimmed piped input from STDIN.
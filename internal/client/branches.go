@@ -0,0 +1,207 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/cpcf/meh/pkg/meh"
+)
+
+// loadBranch replaces the transcript with the current branch of tree.
+func (m *ChatModel) loadBranch(tree meh.Tree) {
+	m.tree = tree
+	m.messages = m.messages[:0]
+	m.turns = nil
+	m.replies = map[int]string{}
+	m.block = 0
+	for _, msg := range tree.Branch() {
+		switch msg.Role {
+		case "user":
+			m.turns = append(m.turns, len(m.messages))
+			m.messages = append(m.messages, m.userLine(msg.Content, len(msg.Images)))
+		case "assistant":
+			if msg.Content != "" || len(msg.ToolCalls) == 0 {
+				m.replies[len(m.messages)] = msg.Content
+				m.messages = append(m.messages, m.replyLine(msg.Content))
+			}
+			for _, call := range msg.ToolCalls {
+				m.messages = append(m.messages, m.noticeStyle.Render("⚙ "+call.String()))
+			}
+		case "tool":
+			m.messages = append(m.messages, m.noticeStyle.Render("↳ "+summarize(msg.Content)))
+		}
+	}
+	m.refreshViewport()
+}
+
+// branchPositions maps the user messages and replies in the transcript, by
+// index in messages, to their position on the current branch of the tree. It
+// is empty while the transcript and the tree disagree, as while a reply
+// streams in.
+func (m ChatModel) branchPositions() map[int]int {
+	var positions []int
+	for i, msg := range m.tree.Branch() {
+		if msg.Role == "user" || msg.Role == "assistant" && (msg.Content != "" || len(msg.ToolCalls) == 0) {
+			positions = append(positions, i)
+		}
+	}
+	lines := m.branchLines()
+	if len(lines) != len(positions) {
+		return nil
+	}
+	byLine := make(map[int]int, len(lines))
+	for j, i := range lines {
+		byLine[i] = positions[j]
+	}
+	return byLine
+}
+
+// branchLines returns the indexes in messages of the user messages and
+// replies, in order.
+func (m ChatModel) branchLines() []int {
+	lines := append([]int(nil), m.turns...)
+	for i := range m.replies {
+		lines = append(lines, i)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// markBranch adds to the first line of the message at index i of messages,
+// at position pos on the branch, which of its alternatives it is and, while
+// browsing, whether it is selected.
+func (m ChatModel) markBranch(line string, i, pos int) string {
+	first, rest, more := strings.Cut(line, "\n")
+	if n, count := m.tree.Siblings(pos); count > 1 {
+		first += m.noticeStyle.Render(fmt.Sprintf(" ‹%d/%d›", n, count))
+	}
+	if m.browsing && i == m.cursor {
+		first = m.senderStyle.Bold(true).Render(cursorMark) + first
+	}
+	if more {
+		return first + "\n" + rest
+	}
+	return first
+}
+
+// cursorMark marks the selected message while browsing.
+const cursorMark = "» "
+
+// startBrowsing selects the last message to move between the branches from.
+func (m *ChatModel) startBrowsing() {
+	positions := m.branchPositions()
+	if len(positions) == 0 {
+		return
+	}
+	m.clearCodeSelection()
+	lines := m.branchLines()
+	m.browsing = true
+	m.cursor = lines[len(lines)-1]
+	m.refreshBrowsing()
+}
+
+// updateBrowsing handles keys while browsing: up and down select a message,
+// left and right switch it for its alternatives, and enter forks the
+// conversation there.
+func (m ChatModel) updateBrowsing(key tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.status = ""
+	switch key.String() {
+	case "up", "k":
+		m.moveCursor(-1)
+	case "down", "j":
+		m.moveCursor(1)
+	case "left", "h":
+		if m.switchBranch(-1) {
+			return m, saveSession(m.api, m.session)
+		}
+	case "right", "l":
+		if m.switchBranch(1) {
+			return m, saveSession(m.api, m.session)
+		}
+	case "enter":
+		m.fork()
+	case "esc", "tab":
+		m.browsing = false
+		m.refreshViewport()
+	case "ctrl+c":
+		m.browsing = false
+		m.refreshViewport()
+		return m.Update(key)
+	}
+	return m, nil
+}
+
+// moveCursor selects the message delta places from the selected one.
+func (m *ChatModel) moveCursor(delta int) {
+	lines := m.branchLines()
+	j := sort.SearchInts(lines, m.cursor) + delta
+	if j < 0 || j >= len(lines) {
+		return
+	}
+	m.cursor = lines[j]
+	m.refreshBrowsing()
+}
+
+// switchBranch replaces the selected message with the alternative delta
+// places from it, showing the branch that continues from there. It reports
+// false if there is no such alternative.
+func (m *ChatModel) switchBranch(delta int) bool {
+	pos, ok := m.branchPositions()[m.cursor]
+	if !ok {
+		return false
+	}
+	tree := m.tree.Clone()
+	if !tree.Switch(pos, delta) {
+		return false
+	}
+	m.api.SetTree(tree)
+	m.loadBranch(tree)
+	for i, p := range m.branchPositions() {
+		if p == pos {
+			m.cursor = i
+		}
+	}
+	m.refreshBrowsing()
+	return true
+}
+
+// fork moves the conversation back to the selected message so the next one
+// sent starts a new branch from there. A message of the user's is taken back
+// to be edited; a reply is kept for the next message to follow.
+func (m *ChatModel) fork() {
+	pos, ok := m.branchPositions()[m.cursor]
+	if !ok {
+		return
+	}
+	tree := m.tree.Clone()
+	msg := tree.Branch()[pos]
+	if msg.Role == "user" {
+		tree.Truncate(pos)
+	} else {
+		tree.Truncate(pos + 1)
+	}
+	m.api.SetTree(tree)
+	m.loadBranch(tree)
+	m.browsing = false
+	if msg.Role == "user" {
+		m.edit(msg)
+		return
+	}
+	m.status = "The next message will continue from the selected reply"
+}
+
+// refreshBrowsing re-renders the transcript and scrolls to the selected
+// message.
+func (m *ChatModel) refreshBrowsing() {
+	transcript := m.transcript()
+	m.viewport.SetContent(transcript)
+	for i, line := range strings.Split(transcript, "\n") {
+		if strings.HasPrefix(ansi.Strip(line), cursorMark) {
+			m.viewport.SetYOffset(i)
+			break
+		}
+	}
+}
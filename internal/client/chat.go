@@ -1,32 +1,52 @@
 package client
 
 import (
+	"context"
 	"fmt"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/cpcf/meh/internal/ollama"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/cpcf/meh/internal/rag"
+	"github.com/cpcf/meh/pkg/meh"
 )
 
-type API interface {
-	Models() []string
-	SelectModel(model string)
-	Chat(query string, results chan string, flag bool)
-	Prompt(query string, results chan string, flag bool)
-}
-
 type ChatModel struct {
-	api          API
+	api          meh.API
+	session      *Session
 	name         string
 	ready        bool
 	viewport     viewport.Model
 	messages     []string
+	turns        []int                 // index in messages of each message the user sent
+	replies      map[int]string        // markdown of the replies, by index in messages
+	md           *glamour.TermRenderer // renders replies, nil to show them raw
+	block        int                   // the selected code block counting back from the latest, 0 for none
+	status       string                // shown below the transcript until the next key
+	tree         meh.Tree              // the conversation as last read from the API, with its branches
+	browsing     bool                  // moving between messages to switch branches or fork
+	cursor       int                   // the selected message while browsing, by index in messages
+	contextSize  int                   // of the model in tokens, 0 if unknown
+	summarizes   bool                  // whether messages that outgrow the context are summarized
+	usage        *meh.Stats            // of the last reply, for the context indicator
+	index        *rag.Index            // searched for passages to add to messages, see /index
+	chunks       int                   // how many passages of index to add
+	retrieve     bool                  // whether index is searched, toggled with ctrl+g
+	searching    *meh.Message          // a message waiting on the search of index
 	textarea     textarea.Model
 	senderStyle  lipgloss.Style
-	results      chan string
+	errorStyle   lipgloss.Style
+	noticeStyle  lipgloss.Style
+	attachments  []string // images for the next message
+	results      chan meh.Event
+	approve      chan<- bool // set while a tool call awaits the user's approval
+	cancel       context.CancelFunc
 	waitingOnLlm bool
 	err          error
 }
@@ -38,9 +58,103 @@ func (m ChatModel) Init() tea.Cmd {
 const gap = "\n\n"
 
 type newLlmMsg struct{}
-type contLlmMsg struct{}
 
-func NewChatModel(persona Persona) ChatModel {
+// contLlmMsg carries the next streamed result. results identifies the stream
+// it came from so results of a cancelled stream can be ignored.
+type contLlmMsg struct {
+	results chan meh.Event
+	event   meh.Event
+	closed  bool
+}
+
+// sessionSavedMsg reports the outcome of saving the session, and carries the
+// conversation that was saved.
+type sessionSavedMsg struct {
+	tree meh.Tree
+	err  error
+}
+
+// copiedMsg reports the outcome of copying a code block to the clipboard.
+// If the system clipboard couldn't be used, terminal holds the code for
+// Update to copy with the terminal's clipboard instead.
+type copiedMsg struct {
+	err      error
+	terminal string
+}
+
+// searchedMsg carries the passages of the index found for the message
+// waiting on the search. ctx is the search's, cancelled if it was stopped.
+type searchedMsg struct {
+	ctx     context.Context
+	results []rag.Result
+	err     error
+}
+
+// rewoundMsg carries the user's last message, taken back from the history to
+// be edited, and the conversation without it.
+type rewoundMsg struct {
+	message meh.Message
+	ok      bool
+	tree    meh.Tree
+}
+
+// saveSession records the conversation once the API has finished with it.
+// It runs as a command because Tree waits for any in-flight reply.
+func saveSession(api meh.API, s *Session) tea.Cmd {
+	return func() tea.Msg {
+		tree := api.Tree()
+		s.Record(tree)
+		return sessionSavedMsg{tree: tree, err: s.Save()}
+	}
+}
+
+func copyCode(code string) tea.Cmd {
+	return func() tea.Msg {
+		if systemClipboard(code) {
+			return copiedMsg{}
+		}
+		return copiedMsg{terminal: code}
+	}
+}
+
+// rewind takes the last exchange back from the API's history, once the
+// stopped reply streaming to results, if any, has been recorded in it.
+func rewind(api meh.API, results chan meh.Event) tea.Cmd {
+	return func() tea.Msg {
+		drain(results)
+		message, ok := api.Rewind()
+		return rewoundMsg{message: message, ok: ok, tree: api.Tree()}
+	}
+}
+
+// search looks for the passages of idx relevant to query.
+func search(ctx context.Context, api meh.API, idx *rag.Index, query string, k int) tea.Cmd {
+	return func() tea.Msg {
+		results, err := searchIndex(ctx, api, idx, query, k)
+		return searchedMsg{ctx: ctx, results: results, err: err}
+	}
+}
+
+// drain waits for a stopped reply streaming to results, if any, to finish.
+func drain(results chan meh.Event) {
+	if results != nil {
+		for range results {
+		}
+	}
+}
+
+// waitForResult reads the next result from the stream without blocking Update.
+func waitForResult(results chan meh.Event) tea.Cmd {
+	return func() tea.Msg {
+		ev, ok := <-results
+		return contLlmMsg{results: results, event: ev, closed: !ok}
+	}
+}
+
+// NewChatModel returns a chat with the persona. If session is nil a new
+// session is started, otherwise its conversation is restored. Replies are
+// rendered as markdown unless raw is set.
+func NewChatModel(persona meh.Persona, session *Session, raw bool) ChatModel {
 	ta := textarea.New()
 	ta.Placeholder = "Enter message..."
 	ta.Focus()
@@ -58,26 +172,70 @@ func NewChatModel(persona Persona) ChatModel {
 
 	vp := viewport.New(30, 5)
 	vp.SetContent(`Interactive Mode.
-Type a message and press Enter to send.`)
+Type a message and press Enter to send.
+Type /attach <path> to attach an image to the next message.
+Press Esc to stop a reply, ctrl+r to regenerate the last one, or up to edit
+your last message.
+Press tab to browse the conversation's branches and fork from any message.
+Press ctrl+o to select a code block from a reply and ctrl+y to copy it.
+Press ctrl+t to fill in a prompt template.
+Type /index <name> to answer from an index made with meh index, and press
+ctrl+g to stop or start searching it.`)
 
 	ta.KeyMap.InsertNewline.SetEnabled(false)
 
-	return ChatModel{
-		api:          ollama.NewAPI(persona.APIURL, persona.Model, persona.SystemPrompt),
+	api, err := meh.NewAPI(persona)
+
+	m := ChatModel{
+		api:          api,
+		session:      session,
 		name:         persona.Name,
 		ready:        true,
 		textarea:     ta,
 		messages:     []string{},
+		replies:      map[int]string{},
 		viewport:     vp,
 		senderStyle:  lipgloss.NewStyle().Foreground(lipgloss.Color("5")),
+		errorStyle:   lipgloss.NewStyle().Foreground(red),
+		noticeStyle:  lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
 		waitingOnLlm: false,
-		err:          nil,
+		contextSize:  persona.ContextSize(),
+		summarizes:   persona.Context == string(meh.ContextSummarize),
+		err:          err,
+	}
+	if err != nil {
+		return m
+	}
+	if !raw {
+		// The renderer is replaced once the window size is known.
+		m.md, _ = newMarkdownRenderer(80)
+	}
+	if session == nil {
+		m.session = NewSession(persona)
+		return m
 	}
+
+	if session.Model != "" {
+		api.SelectModel(session.Model)
+	}
+	tree := session.Conversation()
+	api.SetTree(tree)
+	m.loadBranch(tree)
+	return m
 }
 
 func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	if !m.ready {
-		return m, func() tea.Msg { return switchMsg(mainState) }
+	if !m.ready || m.err != nil {
+		if _, ok := msg.(tea.KeyMsg); ok {
+			return m, func() tea.Msg { return switchMsg(mainState) }
+		}
+		return m, nil
+	}
+	if key, ok := msg.(tea.KeyMsg); ok && m.approve != nil {
+		return m.updateApproval(key)
+	}
+	if key, ok := msg.(tea.KeyMsg); ok && m.browsing {
+		return m.updateBrowsing(key)
 	}
 
 	var (
@@ -93,16 +251,78 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.viewport.Width = msg.Width
 		m.textarea.SetWidth(msg.Width)
 		m.viewport.Height = msg.Height - m.textarea.Height() - lipgloss.Height(gap)
+		if m.md != nil {
+			if md, err := newMarkdownRenderer(msg.Width); err == nil {
+				m.md = md
+				for i := range m.replies {
+					m.renderReply(i)
+				}
+			}
+		}
 
 		if len(m.messages) > 0 {
 			// Wrap content before setting it.
-			m.viewport.SetContent(lipgloss.NewStyle().Width(m.viewport.Width).Render(strings.Join(m.messages, "\n")))
+			m.viewport.SetContent(m.transcript())
 		}
 		m.viewport.GotoBottom()
 	case tea.KeyMsg:
+		m.status = ""
 		switch msg.Type {
-		case tea.KeyCtrlC, tea.KeyEsc:
+		case tea.KeyCtrlT:
+			if m.waitingOnLlm {
+				return m, nil
+			}
+			return m, func() tea.Msg { return openTemplatesMsg{} }
+		case tea.KeyCtrlO:
+			m.selectCode()
+			return m, nil
+		case tea.KeyCtrlG:
+			m.toggleRetrieval()
+			return m, nil
+		case tea.KeyCtrlY:
+			return m, m.copySelectedCode()
+		case tea.KeyEsc:
+			// Esc first lets go of a selected code block.
+			if m.block != 0 {
+				m.clearCodeSelection()
+				return m, nil
+			}
+			// Stopping a search takes the message back to be edited.
+			if m.searching != nil {
+				message := *m.searching
+				m.stopStream()
+				m.truncate(m.turns[len(m.turns)-1])
+				m.edit(message)
+				return m, nil
+			}
+			// Esc stops an in-flight reply; a second Esc leaves the chat.
+			if m.waitingOnLlm {
+				m.interrupt()
+				return m, nil
+			}
 			return m, func() tea.Msg { return switchMsg(mainState) }
+		case tea.KeyCtrlC:
+			m.stopStream()
+			return m, tea.Batch(saveSession(m.api, m.session), func() tea.Msg { return switchMsg(mainState) })
+		case tea.KeyCtrlR:
+			// Regenerating stops the reply in progress, if any.
+			if len(m.turns) == 0 || m.searching != nil {
+				break
+			}
+			return m.regenerate()
+		case tea.KeyUp:
+			// Up in an empty textarea brings back the last message to edit.
+			if m.textarea.Value() != "" || len(m.turns) == 0 || m.searching != nil {
+				break
+			}
+			results := m.results
+			m.stopStream()
+			return m, rewind(m.api, results)
+		case tea.KeyTab:
+			if !m.waitingOnLlm {
+				m.startBrowsing()
+			}
+			return m, nil
 		case tea.KeyEnter:
 			if m.waitingOnLlm {
 				return m, nil
@@ -111,52 +331,522 @@ func (m ChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if strings.TrimSpace(message) == "" {
 				break
 			}
+			if path, ok := strings.CutPrefix(strings.TrimSpace(message), "/attach "); ok {
+				m.textarea.Reset()
+				m.attach(strings.TrimSpace(path))
+				m.refreshViewport()
+				return m, nil
+			}
+			if name, ok := strings.CutPrefix(strings.TrimSpace(message), "/index "); ok {
+				m.textarea.Reset()
+				m.useIndex(strings.TrimSpace(name))
+				m.refreshViewport()
+				return m, nil
+			}
 
-			m.results = make(chan string)
-			go m.api.Chat(message, m.results, true)
-
-			m.messages = append(m.messages, m.senderStyle.Render("You: ")+m.textarea.Value())
-			m.viewport.SetContent(lipgloss.NewStyle().Width(m.viewport.Width).Render(strings.Join(m.messages, "\n")))
+			images := m.attachments
+			m.attachments = nil
 			m.textarea.Reset()
-			m.viewport.GotoBottom()
-
-			m.waitingOnLlm = true
-			return m, func() tea.Msg {
-				return newLlmMsg{}
-			}
+			return m.send(message, images)
 		}
 
+	case rewoundMsg:
+		if !msg.ok || len(m.turns) == 0 {
+			return m, nil
+		}
+		m.clearCodeSelection()
+		// Drop the message and everything after it from the transcript.
+		m.truncate(m.turns[len(m.turns)-1])
+		m.tree = msg.tree
+		m.edit(msg.message)
+		return m, nil
+	case searchedMsg:
+		if msg.ctx.Err() != nil || m.searching == nil {
+			return m, nil
+		}
+		message := *m.searching
+		m.searching = nil
+		if msg.err != nil {
+			m.stopStream()
+			m.truncate(m.turns[len(m.turns)-1])
+			m.messages = append(m.messages, m.errorStyle.Render(fmt.Sprintf("Error: %v", msg.err)))
+			m.edit(message)
+			return m, nil
+		}
+		if len(msg.results) > 0 {
+			m.messages = append(m.messages, m.noticeStyle.Render("Sources: "+sourceList(msg.results)))
+		} else {
+			m.messages = append(m.messages, m.noticeStyle.Render("Nothing found in "+m.index.Name))
+		}
+		return m.chat(retrievalPrompt(message.Content, msg.results), message.Images)
+	case copiedMsg:
+		if msg.terminal != "" {
+			msg.err = terminalClipboard(msg.terminal)
+		}
+		m.status = "Copied the code block to the clipboard"
+		if msg.err != nil {
+			m.status = fmt.Sprintf("Error copying the code block: %v", msg.err)
+		}
+		return m, nil
+	case sessionSavedMsg:
+		m.tree = msg.tree
+		if msg.err != nil {
+			m.messages = append(m.messages, m.errorStyle.Render(fmt.Sprintf("Error saving session: %v", msg.err)))
+			m.refreshViewport()
+			return m, nil
+		}
+		// Show the branches of the saved conversation.
+		m.viewport.SetContent(m.transcript())
+		return m, nil
 	// Add a new LLM message to the history
 	case newLlmMsg:
-		m.messages = append(m.messages, m.senderStyle.Render(fmt.Sprintf("%s: ", m.name))+m.textarea.Value())
-		return m, func() tea.Msg {
-			return contLlmMsg{}
-		}
+		m.replies[len(m.messages)] = ""
+		m.messages = append(m.messages, m.replyPrefix())
+		return m, waitForResult(m.results)
 	// While results are still being streamed in add them to the latest message in the history
 	case contLlmMsg:
-		for res := range m.results {
-			m.messages[len(m.messages)-1] = m.senderStyle.Render(m.messages[len(m.messages)-1] + res)
-			m.viewport.SetContent(lipgloss.NewStyle().Width(m.viewport.Width).Render(strings.Join(m.messages, "\n")))
-			m.viewport.GotoBottom()
-			return m, func() tea.Msg {
-				// we return here so we can render the streamed results
-				return contLlmMsg{}
+		if msg.results != m.results {
+			// A cancelled reply still leaves what was streamed in the history.
+			if msg.closed {
+				return m, saveSession(m.api, m.session)
 			}
+			return m, nil
 		}
-		m.waitingOnLlm = false
-		return m, nil
+		if msg.closed {
+			m.stopStream()
+			return m, saveSession(m.api, m.session)
+		}
+		switch msg.event.Kind {
+		case meh.DoneEvent:
+			stats := msg.event.Stats
+			m.usage = &stats
+			m.session.Usage.Add(stats)
+		case meh.TokenEvent:
+			last := len(m.messages) - 1
+			m.replies[last] += msg.event.Content
+			m.renderReply(last)
+		case meh.ErrorEvent:
+			m.messages = append(m.messages, m.errorStyle.Render(fmt.Sprintf("Error: %v", msg.event.Err)))
+		case meh.ToolCallEvent:
+			// Drop the reply line if the model went straight to a tool call.
+			if last := len(m.messages) - 1; m.messages[last] == m.replyPrefix() {
+				delete(m.replies, last)
+				m.messages = m.messages[:last]
+			}
+			line := "⚙ " + msg.event.Call.String()
+			if msg.event.Approve != nil {
+				line += " Allow? (y/n)"
+				m.approve = msg.event.Approve
+			}
+			m.messages = append(m.messages, m.noticeStyle.Render(line))
+		case meh.ToolResultEvent:
+			m.messages = append(m.messages, m.noticeStyle.Render("↳ "+summarize(msg.event.Content)))
+			m.replies[len(m.messages)] = ""
+			m.messages = append(m.messages, m.replyPrefix())
+		}
+		m.refreshViewport()
+		// we return here so we can render the streamed results
+		return m, waitForResult(m.results)
 	}
 	return m, tea.Batch(tiCmd, vpCmd)
 }
 
+// updateApproval handles keys while a tool call waits for the user to allow
+// or decline it. Esc stops the reply altogether.
+func (m ChatModel) updateApproval(key tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var allowed bool
+	switch key.String() {
+	case "y", "Y":
+		allowed = true
+	case "n", "N":
+	case "esc", "ctrl+c":
+		m.interrupt()
+		return m, nil
+	default:
+		return m, nil
+	}
+	m.approve <- allowed
+	m.approve = nil
+	if !allowed {
+		m.messages = append(m.messages, m.noticeStyle.Render("Declined"))
+		m.refreshViewport()
+	}
+	return m, nil
+}
+
+// send chats with the model, showing message in the transcript and the reply
+// as it streams in. While retrieval is on, the passages of the index found
+// for message are added to it first.
+func (m ChatModel) send(message string, images []string) (tea.Model, tea.Cmd) {
+	m.clearCodeSelection()
+	m.turns = append(m.turns, len(m.messages))
+	m.messages = append(m.messages, m.userLine(message, len(images)))
+	if m.retrieve && m.index != nil {
+		var ctx context.Context
+		ctx, m.cancel = context.WithCancel(context.Background())
+		m.searching = &meh.Message{Role: "user", Content: message, Images: images}
+		m.waitingOnLlm = true
+		m.refreshViewport()
+		return m, search(ctx, m.api, m.index, message, m.chunks)
+	}
+	return m.chat(message, images)
+}
+
+// chat sends message, already shown in the transcript, to the model.
+func (m ChatModel) chat(message string, images []string) (tea.Model, tea.Cmd) {
+	api := m.api
+	return m.startReply(func(ctx context.Context, results chan meh.Event) {
+		api.Attach(images...)
+		api.Chat(ctx, message, results, true)
+	})
+}
+
+// sendPrompt sends text as the user's next message, with any attached
+// images, unless a reply is still coming in.
+func (m ChatModel) sendPrompt(text string) (ChatModel, tea.Cmd) {
+	if !m.ready || m.err != nil || m.waitingOnLlm {
+		return m, nil
+	}
+	images := m.attachments
+	m.attachments = nil
+	model, cmd := m.send(text, images)
+	return model.(ChatModel), cmd
+}
+
+// regenerate replaces the last reply, stopping it if it is still streaming.
+// The old reply stays in the history as another branch.
+func (m ChatModel) regenerate() (tea.Model, tea.Cmd) {
+	old := m.results
+	m.stopStream()
+	m.clearCodeSelection()
+	m.truncate(m.turns[len(m.turns)-1] + 1)
+	api := m.api
+	return m.startReply(func(ctx context.Context, results chan meh.Event) {
+		drain(old)
+		api.Regenerate(ctx, results, true)
+	})
+}
+
+// startReply runs request in the background to stream a reply into the
+// transcript.
+func (m ChatModel) startReply(request func(ctx context.Context, results chan meh.Event)) (tea.Model, tea.Cmd) {
+	var ctx context.Context
+	ctx, m.cancel = context.WithCancel(context.Background())
+	m.results = make(chan meh.Event)
+	results := m.results
+	go request(ctx, results)
+	m.refreshViewport()
+
+	m.waitingOnLlm = true
+	return m, func() tea.Msg {
+		return newLlmMsg{}
+	}
+}
+
+// edit puts message in the textarea to be changed and sent again.
+func (m *ChatModel) edit(message meh.Message) {
+	m.textarea.SetValue(message.Content)
+	m.attachments = append(message.Images, m.attachments...)
+	if len(m.attachments) > 0 {
+		m.status = fmt.Sprintf("%d image(s) attached to the message", len(m.attachments))
+	}
+	m.refreshViewport()
+}
+
+// truncate drops the transcript from index n of messages on.
+func (m *ChatModel) truncate(n int) {
+	for len(m.turns) > 0 && m.turns[len(m.turns)-1] >= n {
+		m.turns = m.turns[:len(m.turns)-1]
+	}
+	for i := range m.replies {
+		if i >= n {
+			delete(m.replies, i)
+		}
+	}
+	m.messages = m.messages[:n]
+}
+
+// interrupt stops the reply in progress, marking it in the transcript. What
+// was streamed is kept, in the transcript and the history.
+func (m *ChatModel) interrupt() {
+	m.stopStream()
+	m.messages = append(m.messages, m.noticeStyle.Render("(interrupted)"))
+	m.refreshViewport()
+}
+
+// replyPrefix is the transcript line that starts an assistant reply.
+func (m ChatModel) replyPrefix() string {
+	return m.senderStyle.Render(fmt.Sprintf("%s: ", m.name))
+}
+
+// replyLine renders an assistant reply for the transcript, as markdown below
+// the persona's name unless replies are shown raw.
+func (m ChatModel) replyLine(content string) string {
+	if m.md == nil || content == "" {
+		return m.senderStyle.Render(fmt.Sprintf("%s: ", m.name) + content)
+	}
+	return m.replyPrefix() + "\n" + renderMarkdown(m.md, content)
+}
+
+// renderReply renders the reply at index i of messages, marking the selected
+// code block if it is in the reply.
+func (m *ChatModel) renderReply(i int) {
+	reply := m.replies[i]
+	if ref, n, total, ok := m.selectedCode(); ok && ref.message == i {
+		reply = reply[:ref.start] + fmt.Sprintf("**%s %d/%d**\n\n", codeLabel, n, total) + reply[ref.start:]
+	}
+	m.messages[i] = m.replyLine(reply)
+}
+
+// codeLabel marks the selected code block in the transcript.
+const codeLabel = "▶ code block"
+
+// codeRef locates a fenced code block in the transcript.
+type codeRef struct {
+	message int // index of the reply in messages
+	codeBlock
+}
+
+// codeIndex returns the code blocks in the replies, in transcript order.
+func (m ChatModel) codeIndex() []codeRef {
+	indexes := make([]int, 0, len(m.replies))
+	for i := range m.replies {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	var refs []codeRef
+	for _, i := range indexes {
+		for _, block := range codeBlocks(m.replies[i]) {
+			refs = append(refs, codeRef{message: i, codeBlock: block})
+		}
+	}
+	return refs
+}
+
+// selectedCode returns the selected code block, its number counting from the
+// first in the transcript, and the number of code blocks.
+func (m ChatModel) selectedCode() (ref codeRef, n, total int, ok bool) {
+	if m.block == 0 {
+		return codeRef{}, 0, 0, false
+	}
+	refs := m.codeIndex()
+	if m.block > len(refs) {
+		return codeRef{}, 0, len(refs), false
+	}
+	n = len(refs) - m.block
+	return refs[n], n + 1, len(refs), true
+}
+
+// selectCode selects the code block before the selected one, starting from
+// the latest and wrapping around, and scrolls the transcript to it.
+func (m *ChatModel) selectCode() {
+	total := len(m.codeIndex())
+	if total == 0 {
+		m.status = "There are no code blocks to select"
+		return
+	}
+	prev, _, _, selected := m.selectedCode()
+	m.block = m.block%total + 1
+	if selected {
+		m.renderReply(prev.message)
+	}
+	ref, _, _, _ := m.selectedCode()
+	m.renderReply(ref.message)
+	m.refreshViewport()
+
+	// Scroll to the label above the block.
+	for i, line := range strings.Split(m.transcript(), "\n") {
+		if strings.Contains(ansi.Strip(line), codeLabel) {
+			m.viewport.SetYOffset(i)
+			break
+		}
+	}
+}
+
+// clearCodeSelection lets go of the selected code block, if any.
+func (m *ChatModel) clearCodeSelection() {
+	ref, _, _, ok := m.selectedCode()
+	m.block = 0
+	if ok {
+		m.renderReply(ref.message)
+		m.refreshViewport()
+	}
+}
+
+// copySelectedCode copies the selected code block, or the latest one if none
+// is selected, to the clipboard.
+func (m *ChatModel) copySelectedCode() tea.Cmd {
+	if m.block == 0 {
+		refs := m.codeIndex()
+		if len(refs) == 0 {
+			m.status = "There are no code blocks to copy"
+			return nil
+		}
+		return copyCode(refs[len(refs)-1].code)
+	}
+	ref, _, _, ok := m.selectedCode()
+	if !ok {
+		return nil
+	}
+	return copyCode(ref.code)
+}
+
+// summarize shortens tool output to its first line for the transcript.
+func summarize(output string) string {
+	line, _, more := strings.Cut(strings.TrimSpace(output), "\n")
+	if r := []rune(line); len(r) > 60 {
+		line, more = string(r[:60]), true
+	}
+	if more {
+		line += "…"
+	}
+	return line
+}
+
+// refreshViewport re-renders the transcript and scrolls to the latest message.
+func (m *ChatModel) refreshViewport() {
+	m.viewport.SetContent(m.transcript())
+	m.viewport.GotoBottom()
+}
+
+// transcript returns the messages wrapped to the width of the viewport, with
+// the branches they are on marked.
+func (m ChatModel) transcript() string {
+	lines := append([]string(nil), m.messages...)
+	for i, pos := range m.branchPositions() {
+		lines[i] = m.markBranch(lines[i], i, pos)
+	}
+	return lipgloss.NewStyle().Width(m.viewport.Width).Render(strings.Join(lines, "\n"))
+}
+
+// statsLine shows the index being searched, the stats of the last reply and
+// how much of the model's context window the conversation took up, warning
+// when it is nearly full.
+func (m ChatModel) statsLine() string {
+	style := m.noticeStyle
+	var parts []string
+	if m.retrieve && m.index != nil {
+		parts = append(parts, "index "+m.index.Name)
+	}
+	if m.usage == nil {
+		return style.MaxWidth(m.viewport.Width).Render(strings.Join(parts, " • "))
+	}
+	if s := formatStats(*m.usage); s != "" {
+		parts = append(parts, s)
+	}
+	if m.usage.PromptEvalCount > 0 {
+		used := m.usage.PromptEvalCount + m.usage.EvalCount
+		s := fmt.Sprintf("context %d tokens", used)
+		if m.contextSize > 0 {
+			percent := used * 100 / m.contextSize
+			s = fmt.Sprintf("context %d/%d tokens (%d%%)", used, m.contextSize, percent)
+			if percent >= 90 {
+				style = m.errorStyle
+			}
+		}
+		parts = append(parts, s)
+	}
+	if n := m.usage.Dropped; n > 0 && m.summarizes {
+		parts = append(parts, fmt.Sprintf("%d earlier messages summarized", n))
+	} else if n > 0 {
+		parts = append(parts, fmt.Sprintf("%d earlier messages left out", n))
+	}
+	if u := m.session.Usage; u.Replies > 1 {
+		parts = append(parts, fmt.Sprintf("session %d tokens", u.PromptTokens+u.Tokens))
+	}
+	return style.MaxWidth(m.viewport.Width).Render(strings.Join(parts, " • "))
+}
+
+// userLine renders a message sent by the user for the transcript.
+func (m ChatModel) userLine(content string, images int) string {
+	line := m.senderStyle.Render("You: ") + content
+	if images > 0 {
+		line += m.noticeStyle.Render(fmt.Sprintf(" (+%d image(s))", images))
+	}
+	return line
+}
+
+// attach loads an image to send with the next message.
+func (m *ChatModel) attach(path string) {
+	img, err := meh.LoadImage(path)
+	if err != nil {
+		m.messages = append(m.messages, m.errorStyle.Render(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	m.attachments = append(m.attachments, img)
+	m.messages = append(m.messages, m.noticeStyle.Render(fmt.Sprintf("Attached %s to the next message", filepath.Base(path))))
+}
+
+// useIndex loads the index called name and searches it for each message.
+func (m *ChatModel) useIndex(name string) {
+	idx, err := loadIndex(name)
+	if err != nil {
+		m.messages = append(m.messages, m.errorStyle.Render(fmt.Sprintf("Error: %v", err)))
+		return
+	}
+	m.setIndex(idx, m.chunks)
+	m.messages = append(m.messages, m.noticeStyle.Render(fmt.Sprintf("Searching %s for each message, ctrl+g to stop", idx.Name)))
+}
+
+// setIndex searches idx for k passages to add to each message, or the
+// default number if k is 0.
+func (m *ChatModel) setIndex(idx *rag.Index, k int) {
+	if k <= 0 {
+		k = defaultChunks
+	}
+	m.index, m.chunks, m.retrieve = idx, k, idx != nil
+}
+
+// toggleRetrieval stops or starts searching the index for each message.
+func (m *ChatModel) toggleRetrieval() {
+	switch {
+	case m.index == nil:
+		m.status = "No index to search, choose one with /index <name>"
+	case m.retrieve:
+		m.retrieve = false
+		m.status = "Stopped searching " + m.index.Name
+	default:
+		m.retrieve = true
+		m.status = "Searching " + m.index.Name + " for each message"
+	}
+}
+
+// stopStream cancels the in-flight reply, if any, and stops waiting on it.
+func (m *ChatModel) stopStream() {
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+	m.results = nil
+	m.approve = nil
+	m.searching = nil
+	m.waitingOnLlm = false
+}
+
 func (m ChatModel) View() string {
 	if !m.ready {
 		return "No persona selected.\nPress any key to return."
 	}
+	if m.err != nil {
+		return m.errorStyle.Render(fmt.Sprintf("Error: %v", m.err)) + "\nPress any key to return."
+	}
+	// The status line takes the place of the gap's blank line.
+	status := m.status
+	if _, n, total, ok := m.selectedCode(); ok && status == "" {
+		status = fmt.Sprintf("Code block %d/%d • ctrl+y copy • ctrl+o previous • esc done", n, total)
+	}
+	if m.browsing && status == "" {
+		status = "↑/↓ select • ←/→ switch branch • enter fork here • esc done"
+	}
+	if status == "" {
+		status = m.statsLine()
+	} else {
+		status = m.noticeStyle.MaxWidth(m.viewport.Width).Render(status)
+	}
 	return fmt.Sprintf(
-		"%s%s%s",
+		"%s\n%s\n%s",
 		m.viewport.View(),
-		gap,
+		status,
 		m.textarea.View(),
 	)
 }
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"os"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/aymanbagabas/go-osc52/v2"
+)
+
+// systemClipboard puts text on the system clipboard. It reports false over
+// SSH, where that clipboard isn't the user's, or when no clipboard program is
+// available.
+func systemClipboard(text string) bool {
+	if os.Getenv("SSH_TTY") != "" || os.Getenv("SSH_CONNECTION") != "" {
+		return false
+	}
+	return clipboard.WriteAll(text) == nil
+}
+
+// terminalClipboard asks the terminal to put text on its clipboard with an
+// OSC52 sequence. The sequence goes to the controlling terminal rather than
+// stdout, and must be sent from Update so it can't land in the middle of the
+// renderer's output.
+func terminalClipboard(text string) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+	// tmux takes the plain sequence when its set-clipboard option is on.
+	seq := osc52.New(text)
+	if os.Getenv("TMUX") == "" && strings.HasPrefix(os.Getenv("TERM"), "screen") {
+		seq = seq.Screen()
+	}
+	_, err = seq.WriteTo(tty)
+	return err
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cpcf/meh/pkg/meh"
+)
+
+// command is a subcommand run in place of a query, e.g. meh models list.
+// persona is the one selected with -p or the default, and may be zero.
+type command func(ctx context.Context, conf *meh.Config, persona meh.Persona, args []string) error
+
+var commands = map[string]command{
+	"embed":   runEmbed,
+	"index":   runIndex,
+	"models":  runModels,
+	"persona": runPersona,
+	"serve":   runServe,
+	"similar": runSimilar,
+}
+
+// IsCommand reports whether name is a subcommand rather than the start of a
+// query.
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// runCommand runs the subcommand named by args[0] with the rest of args.
+func runCommand(ctx context.Context, conf *meh.Config, persona meh.Persona, args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	return cmd(ctx, conf, persona, args[1:])
+}
+
+// UsageError is returned by subcommands given the wrong arguments. Its
+// message is the subcommand's usage.
+type UsageError string
+
+func (e UsageError) Error() string { return string(e) }
+
+// needPersona returns an error if no persona was selected.
+func needPersona(persona meh.Persona) error {
+	if persona.IsZero() {
+		return errors.New("no persona selected, create one in the TUI or select one with -p")
+	}
+	return nil
+}
+
+// formatSize renders a byte count in decimal units, as Ollama does.
+func formatSize(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -1,14 +1,13 @@
 package client
 
 import (
-	"errors"
 	"fmt"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/huh"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/cpcf/meh/internal/ollama"
+	"github.com/cpcf/meh/pkg/meh"
 )
 
 const (
@@ -17,69 +16,111 @@ const (
 )
 
 type CreatePersonaModel struct {
-	config *Config
+	config *meh.Config
 	lg     *lipgloss.Renderer
 	styles *Styles
 	form   *huh.Form
 	width  int
 	height int
 	done   bool
+	// original is the persona being edited, or nil when creating one.
+	original *meh.Persona
+	err      error
 }
 
-func NewCreatePersonaModel(c *Config) CreatePersonaModel {
+func NewCreatePersonaModel(c *meh.Config) CreatePersonaModel {
+	return newPersonaForm(c, meh.Persona{}, nil)
+}
+
+// NewEditPersonaModel returns the persona form prefilled with p, saving the
+// changes over it.
+func NewEditPersonaModel(c *meh.Config, p meh.Persona) CreatePersonaModel {
+	return newPersonaForm(c, p, &p)
+}
+
+// newPersonaForm builds the form starting from the values in p.
+func newPersonaForm(c *meh.Config, p meh.Persona, original *meh.Persona) CreatePersonaModel {
 	m := CreatePersonaModel{
-		width:  maxWidth,
-		config: c,
+		width:    maxWidth,
+		config:   c,
+		original: original,
 	}
 	m.lg = lipgloss.DefaultRenderer()
 	m.styles = NewStyles(m.lg)
 	var (
-		url string
+		name      = p.Name
+		provider  = p.Provider
+		url       = p.APIURL
+		model     = p.Model
+		prompt    = p.SystemPrompt
+		strategy  = p.Context
+		isDefault = original != nil && c.DefaultPersona == original.Name
+		oldName   string
 	)
+	if provider == "" {
+		provider = meh.DefaultProvider
+	}
+	if strategy == "" {
+		strategy = string(meh.ContextFull)
+	}
+	if original != nil {
+		oldName = original.Name
+	}
 	m.form = huh.NewForm(
 		huh.NewGroup(
 			huh.NewInput().
 				Key("name").
+				Value(&name).
 				Title("Persona name").
 				Validate(func(str string) error {
-					if _, ok := FindPersona(*m.config, str); ok {
-						return errors.New("That persona already exists.")
-					}
-					if str == "" {
-						return errors.New("Name cannot be empty")
-					}
-					return nil
+					return m.config.ValidatePersonaName(str, oldName)
 				}),
+			huh.NewSelect[string]().
+				Key("provider").
+				Value(&provider).
+				Title("Provider").
+				Options(huh.NewOptions(meh.ProviderNames()...)...),
 			huh.NewInput().
 				Key("url").
 				Value(&url).
 				Title("API URL").
 				Validate(func(str string) error {
-					api := ollama.NewAPI(str, "", "")
-					if !api.Verify() {
-						return errors.New("Could not connect to API")
-					}
-					return nil
+					return meh.ValidateAPIURL(meh.Persona{Provider: provider, APIURL: str, HTTP: p.HTTP})
 				}),
 			huh.NewSelect[string]().
 				Key("model").
+				Value(&model).
 				Title("Model").
 				OptionsFunc(func() []huh.Option[string] {
 					if url == "" {
 						return []huh.Option[string]{}
 					}
-					a := ollama.NewAPI(url, "", "")
+					a, err := meh.NewAPI(meh.Persona{Provider: provider, APIURL: url, HTTP: p.HTTP})
+					if err != nil {
+						return []huh.Option[string]{}
+					}
 					m := a.Models()
 					return huh.NewOptions(m...)
-				}, &url),
+				}, []*string{&provider, &url}),
 		),
+		huh.NewGroup(append(optionFields(p.Options),
+			huh.NewSelect[string]().
+				Key("context").
+				Value(&strategy).
+				Title("Context strategy").
+				Description("What to send once a chat outgrows num_ctx").
+				Options(huh.NewOptions(meh.ContextStrategies()...)...),
+		)...).
+			Title("Generation Options"),
 		huh.NewGroup(
 			huh.NewText().
 				Key("prompt").
+				Value(&prompt).
 				Title("System Prompt").
 				Placeholder("Optional"),
 			huh.NewConfirm().
 				Key("default").
+				Value(&isDefault).
 				Title("Set as default persona?").
 				Affirmative("Yes").
 				Negative("No"),
@@ -131,12 +172,29 @@ func (m CreatePersonaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	}
 
 	if !m.done && m.form.State == huh.StateCompleted {
-		persona := Persona{}
+		// Settings the form doesn't cover, such as tools, are kept when editing.
+		persona := meh.Persona{}
+		if m.original != nil {
+			persona = *m.original
+		}
 		persona.Name = m.form.GetString("name")
+		persona.Provider = m.form.GetString("provider")
 		persona.APIURL = m.form.GetString("url")
 		persona.Model = m.form.GetString("model")
 		persona.SystemPrompt = m.form.GetString("prompt")
-		m.config.AddPersona(persona, m.form.GetBool("default"))
+		persona.Options = formOptions(m.form)
+		persona.Context = m.form.GetString("context")
+		if persona.Context == string(meh.ContextFull) {
+			persona.Context = ""
+		}
+		if m.original != nil {
+			m.err = m.config.UpdatePersona(m.original.Name, persona, m.form.GetBool("default"))
+		} else {
+			m.err = m.config.AddPersona(persona, m.form.GetBool("default"))
+		}
+		if m.err != nil {
+			return m, tea.Batch(cmds...)
+		}
 		cmds = append(cmds, BackToMain, SetPersonaCmd(persona))
 		m.done = true
 	}
@@ -146,8 +204,10 @@ func (m CreatePersonaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m CreatePersonaModel) View() string {
 	s := m.styles
-	switch m.form.State {
-	case huh.StateCompleted:
+	switch {
+	case m.err != nil:
+		return s.Base.Render(appErrorBoundaryView(&m, m.err.Error()) + "\n\nPress esc to return.")
+	case m.form.State == huh.StateCompleted:
 		return ""
 	default:
 
@@ -156,16 +216,22 @@ func (m CreatePersonaModel) View() string {
 		form := m.lg.NewStyle().Margin(1, 0).Render(v)
 
 		// Status (right side)
-		p := Persona{
+		p := meh.Persona{
 			Name:         m.form.GetString("name"),
+			Provider:     m.form.GetString("provider"),
 			APIURL:       m.form.GetString("url"),
 			Model:        m.form.GetString("model"),
 			SystemPrompt: m.form.GetString("prompt"),
+			Options:      formOptions(m.form),
 		}
 		status := CreateStatusBar(s, p, m.width-lipgloss.Width(form), m.Height()-8, "Current Persona")
 
 		errors := m.form.Errors()
-		header := appBoundaryView(&m, "Persona Creator")
+		title := "Persona Creator"
+		if m.original != nil {
+			title = "Persona Editor"
+		}
+		header := appBoundaryView(&m, title)
 		if len(errors) > 0 {
 			header = appErrorBoundaryView(&m, m.errorView())
 		}
@@ -205,3 +271,44 @@ func (m CreatePersonaModel) errorView() string {
 	}
 	return s
 }
+
+// optionFields returns an optional input for each generation option, filled
+// in from options.
+func optionFields(options meh.Options) []huh.Field {
+	names := meh.OptionNames()
+	fields := make([]huh.Field, len(names))
+	for i, name := range names {
+		name := name
+		value := options.Value(name)
+		fields[i] = huh.NewInput().
+			Key(optionKey(name)).
+			Value(&value).
+			Title(name).
+			Placeholder("Server default").
+			Validate(func(str string) error {
+				_, err := meh.ParseOption(name, str)
+				return err
+			})
+	}
+	return fields
+}
+
+// formOptions collects the generation options entered in the form.
+func formOptions(f *huh.Form) meh.Options {
+	var options meh.Options
+	for _, name := range meh.OptionNames() {
+		v, err := meh.ParseOption(name, f.GetString(optionKey(name)))
+		if err != nil || v == nil {
+			continue
+		}
+		if options == nil {
+			options = meh.Options{}
+		}
+		options[name] = v
+	}
+	return options
+}
+
+func optionKey(name string) string {
+	return "option_" + name
+}
@@ -0,0 +1,209 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cpcf/meh/internal/rag"
+	"github.com/cpcf/meh/pkg/meh"
+)
+
+const embedUsage = `Usage: meh [-p persona] embed [flags]
+
+Embed each line read from stdin with the persona's Ollama server, printing one
+JSON object per line: {"text": "...", "embedding": [...]}. Blank lines are
+skipped. Lines are embedded and printed a batch at a time as they arrive.
+
+Flags:
+` + embedFlagsUsage
+
+const similarUsage = `Usage: meh [-p persona] similar [flags] <query>
+
+Rank the lines read from stdin by how similar they are in meaning to query,
+most similar first, printing each with its cosine similarity. Blank lines are
+skipped.
+
+Flags:
+  -n count           Print only the count most similar lines
+` + embedFlagsUsage
+
+const embedFlagsUsage = `  -model model       Embedding model (default: ` + defaultEmbedModel + `)
+  -batch n           Lines embedded per request (default 32)
+  -truncate=false    Fail on lines too long for the model instead of cutting them down
+  -dimensions n      Shorten embeddings to n dimensions, for models that support it`
+
+// maxLineSize is the longest line meh embed and meh similar read.
+const maxLineSize = 1 << 20
+
+// embedFlags are the flags shared by meh embed and meh similar.
+type embedFlags struct {
+	fs         *flag.FlagSet
+	model      *string
+	batch      *int
+	truncate   *bool
+	dimensions *int
+}
+
+func newEmbedFlags(name string) embedFlags {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return embedFlags{
+		fs:         fs,
+		model:      fs.String("model", defaultEmbedModel, ""),
+		batch:      fs.Int("batch", meh.DefaultEmbedBatch, ""),
+		truncate:   fs.Bool("truncate", true, ""),
+		dimensions: fs.Int("dimensions", 0, ""),
+	}
+}
+
+// embedder returns the persona's API set up to embed as the flags say.
+func (f embedFlags) embedder(persona meh.Persona) (meh.Embedder, error) {
+	if err := needPersona(persona); err != nil {
+		return nil, err
+	}
+	embedder, err := newEmbedder(persona)
+	if err != nil {
+		return nil, err
+	}
+	embedder.SetEmbedOptions(meh.EmbedOptions{BatchSize: *f.batch, Truncate: *f.truncate, Dimensions: *f.dimensions})
+	return embedder, nil
+}
+
+// runEmbed implements meh embed.
+func runEmbed(ctx context.Context, conf *meh.Config, persona meh.Persona, args []string) error {
+	f := newEmbedFlags("embed")
+	if err := f.fs.Parse(args); err != nil || f.fs.NArg() > 0 {
+		return UsageError(embedUsage)
+	}
+	embedder, err := f.embedder(persona)
+	if err != nil {
+		return err
+	}
+	// Embed each batch as soon as it is read, so a long or endless stream
+	// isn't held in memory or kept waiting for its end.
+	size := *f.batch
+	out := bufio.NewWriter(os.Stdout)
+	enc := json.NewEncoder(out)
+	var batch []string
+	emit := func() error {
+		vectors, err := embedder.Embed(ctx, *f.model, batch)
+		if err != nil {
+			return err
+		}
+		for i, line := range batch {
+			record := struct {
+				Text      string    `json:"text"`
+				Embedding []float32 `json:"embedding"`
+			}{line, vectors[i]}
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return out.Flush()
+	}
+	n := 0
+	err = scanLines(os.Stdin, func(line string) error {
+		batch = append(batch, line)
+		n++
+		if size > 0 && len(batch) >= size {
+			return emit()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNoLines
+	}
+	if len(batch) > 0 {
+		return emit()
+	}
+	return nil
+}
+
+// runSimilar implements meh similar.
+func runSimilar(ctx context.Context, conf *meh.Config, persona meh.Persona, args []string) error {
+	f := newEmbedFlags("similar")
+	count := f.fs.Int("n", 0, "")
+	if err := f.fs.Parse(args); err != nil || f.fs.NArg() == 0 {
+		return UsageError(similarUsage)
+	}
+	query := strings.Join(f.fs.Args(), " ")
+	embedder, err := f.embedder(persona)
+	if err != nil {
+		return err
+	}
+	lines, err := readLines(os.Stdin)
+	if err != nil {
+		return err
+	}
+	vectors, err := embedder.Embed(ctx, *f.model, append([]string{query}, lines...))
+	if err != nil {
+		return err
+	}
+
+	type ranked struct {
+		line  string
+		score float32
+	}
+	ranking := make([]ranked, len(lines))
+	for i, line := range lines {
+		ranking[i] = ranked{line, rag.Similarity(vectors[0], vectors[i+1])}
+	}
+	sort.SliceStable(ranking, func(i, j int) bool { return ranking[i].score > ranking[j].score })
+	if *count > 0 && *count < len(ranking) {
+		ranking = ranking[:*count]
+	}
+	out := bufio.NewWriter(os.Stdout)
+	for _, r := range ranking {
+		fmt.Fprintf(out, "%.4f\t%s\n", r.score, r.line)
+	}
+	return out.Flush()
+}
+
+// errNoLines is returned when stdin holds nothing to embed.
+var errNoLines = errors.New("no lines to embed on stdin")
+
+// readLines returns the lines read from r that aren't blank.
+func readLines(r io.Reader) ([]string, error) {
+	var lines []string
+	err := scanLines(r, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, errNoLines
+	}
+	return lines, nil
+}
+
+// scanLines calls fn with each line read from r that isn't blank, stopping at
+// the first error it returns.
+func scanLines(r io.Reader, fn func(line string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.TrimSpace(line) != "" {
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading stdin: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cpcf/meh/pkg/meh"
+)
+
+// defaultInputBudget is the token budget of -f files when the persona's
+// context window isn't known.
+const defaultInputBudget = 32000
+
+// binarySniffLen is how much of a file is checked for NUL bytes, as git does,
+// to tell binary files from text.
+const binarySniffLen = 8000
+
+// inputBudget returns how many tokens the files given with -f may take up:
+// the -budget flag, or three quarters of the persona's context window, to
+// leave room for the query and the reply.
+func inputBudget(opts Options, persona meh.Persona) int {
+	if opts.Budget > 0 {
+		return opts.Budget
+	}
+	if size := persona.ContextSize(); size > 0 {
+		return size - size/4
+	}
+	return defaultInputBudget
+}
+
+// readInputFiles reads the files named by patterns, each a file, a glob or a
+// directory to read recursively, and returns them wrapped in fenced blocks
+// labelled with their paths. Files matched by a glob or found in a directory
+// are skipped if .gitignore excludes them or they are binary. Files that
+// would take the total over budget tokens are left out, with a warning.
+func readInputFiles(patterns []string, budget int) (string, error) {
+	paths, err := expandInputPaths(patterns)
+	if err != nil {
+		return "", err
+	}
+	var (
+		b       strings.Builder
+		used    int
+		skipped []string
+	)
+	for _, p := range paths {
+		data, err := os.ReadFile(p.path)
+		if err != nil {
+			return "", fmt.Errorf("error reading file: %w", err)
+		}
+		if isBinary(data) {
+			if p.explicit {
+				fmt.Fprintf(os.Stderr, "[skipped %s: binary file]\n", p.path)
+			}
+			continue
+		}
+		block := fileBlock(p.path, string(data))
+		tokens := meh.EstimateTokens(meh.Message{Content: block})
+		if used+tokens > budget {
+			skipped = append(skipped, p.path)
+			continue
+		}
+		used += tokens
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(block)
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(os.Stderr, "[skipped %s: over the input budget of %d tokens, see -budget]\n", strings.Join(skipped, ", "), budget)
+	}
+	if b.Len() == 0 {
+		return "", errors.New("no text files to read within the input budget")
+	}
+	return b.String(), nil
+}
+
+// inputPath is a file to read for -f.
+type inputPath struct {
+	path     string
+	explicit bool // named on the command line rather than found by a glob or in a directory
+}
+
+// expandInputPaths lists the files named by patterns, in order and without
+// duplicates.
+func expandInputPaths(patterns []string) ([]inputPath, error) {
+	var (
+		paths []inputPath
+		seen  = map[string]bool{}
+	)
+	add := func(p string, explicit bool) {
+		if abs, err := filepath.Abs(p); err == nil && !seen[abs] {
+			seen[abs] = true
+			paths = append(paths, inputPath{path: p, explicit: explicit})
+		}
+	}
+	for _, pattern := range patterns {
+		if info, err := os.Stat(pattern); err == nil {
+			if !info.IsDir() {
+				add(pattern, true)
+				continue
+			}
+			files, err := walkDir(pattern)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range files {
+				add(f, false)
+			}
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || globIgnored(match, info.IsDir()) {
+				continue
+			}
+			if info.IsDir() {
+				files, err := walkDir(match)
+				if err != nil {
+					return nil, err
+				}
+				for _, f := range files {
+					add(f, false)
+				}
+				continue
+			}
+			add(match, false)
+		}
+	}
+	return paths, nil
+}
+
+// globIgnored reports whether .gitignore excludes the file or directory at p,
+// or a directory it is in below the root of its repository, as it would be
+// skipped when walking the repository.
+func globIgnored(p string, isDir bool) bool {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return false
+	}
+	dir := filepath.Dir(abs)
+	root, ok := repoRoot(dir)
+	if !ok {
+		return newGitignore(dir).ignored(abs, isDir)
+	}
+	var parents []string
+	for d := dir; d != root; d = filepath.Dir(d) {
+		parents = append(parents, d)
+	}
+	g := newGitignore(root)
+	for i := len(parents) - 1; i >= 0; i-- {
+		if filepath.Base(parents[i]) == ".git" || g.ignored(parents[i], true) {
+			return true
+		}
+		g.load(parents[i])
+	}
+	return g.ignored(abs, isDir)
+}
+
+// walkDir lists the files under dir that .gitignore doesn't exclude,
+// skipping .git directories.
+func walkDir(dir string) ([]string, error) {
+	ignore := newGitignore(dir)
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != dir && (d.Name() == ".git" || ignore.ignored(p, true)) {
+				return filepath.SkipDir
+			}
+			if p != dir {
+				ignore.load(p)
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && !ignore.ignored(p, false) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// isBinary reports whether data looks like the contents of a binary file: it
+// has a NUL byte near the start.
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), binarySniffLen)], 0) >= 0
+}
+
+// fileBlock wraps the contents of the file at path in a fenced code block,
+// labelled with the path and tagged with its extension for highlighting.
+func fileBlock(path, content string) string {
+	return filepath.ToSlash(path) + ":\n" + codeFence(filepath.Ext(path), content)
+}
+
+// codeFence wraps content in a fenced code block tagged with ext, the
+// extension of the file it came from, using a fence that content doesn't
+// contain.
+func codeFence(ext, content string) string {
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	return fmt.Sprintf("%s%s\n%s\n%s", fence, strings.TrimPrefix(ext, "."), strings.TrimRight(content, "\n"), fence)
+}
+
+// gitignore holds the .gitignore rules that apply to a directory tree.
+type gitignore struct {
+	rules []ignoreRule
+}
+
+// ignoreRule is a pattern from a .gitignore file.
+type ignoreRule struct {
+	base     string // the absolute directory of the .gitignore file
+	pattern  string
+	negate   bool // the pattern started with !
+	dirOnly  bool // the pattern ended with /
+	anchored bool // the pattern is matched against the path from base, not just the name
+}
+
+// newGitignore returns the rules of the .gitignore files in dir and its
+// parents up to the root of the git repository it is in, if any.
+func newGitignore(dir string) *gitignore {
+	g := &gitignore{}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return g
+	}
+	dirs := []string{abs}
+	// Without a repository only dir's own .gitignore applies.
+	if root, ok := repoRoot(abs); ok {
+		for d := abs; d != root; {
+			d = filepath.Dir(d)
+			dirs = append(dirs, d)
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		g.load(dirs[i])
+	}
+	return g
+}
+
+// repoRoot returns the root of the git repository holding the absolute
+// directory dir, reporting false if it isn't in one.
+func repoRoot(dir string) (string, bool) {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d, true
+		}
+		if filepath.Dir(d) == d {
+			return "", false
+		}
+	}
+}
+
+// load adds the rules of the .gitignore file in dir, if there is one.
+func (g *gitignore) load(dir string) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	f, err := os.Open(filepath.Join(abs, ".gitignore"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r := ignoreRule{base: abs}
+		if strings.HasPrefix(line, "!") {
+			r.negate, line = true, line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly, line = true, strings.TrimSuffix(line, "/")
+		}
+		r.anchored = strings.Contains(line, "/")
+		r.pattern = strings.TrimPrefix(line, "/")
+		g.rules = append(g.rules, r)
+	}
+}
+
+// ignored reports whether the rules exclude the file or directory at p. As in
+// git, the last matching rule wins.
+func (g *gitignore) ignored(p string, isDir bool) bool {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return false
+	}
+	ignored := false
+	for _, r := range g.rules {
+		if r.matches(abs, isDir) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+func (r ignoreRule) matches(abs string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	rel, err := filepath.Rel(r.base, abs)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if !r.anchored {
+		ok, _ := path.Match(r.pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(r.pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches a path against a pattern, both split at slashes,
+// where a ** segment matches any number of path segments.
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], segments[0])
+	return ok && matchSegments(pattern[1:], segments[1:])
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeTree creates the files in dir, creating directories as needed.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGitignore(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".git/HEAD": "",
+		".gitignore": strings.Join([]string{
+			"# comment",
+			"*.log",
+			"!keep.log",
+			"build/",
+			"/top.txt",
+			"docs/**/*.tmp",
+			`\#hash`,
+		}, "\n"),
+		"sub/.gitignore": "*.bak\n",
+	})
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"a.go", false, false},
+		{"a.log", false, true},
+		{"sub/deep/a.log", false, true},
+		{"keep.log", false, false},
+		{"sub/keep.log", false, false},
+		{"build", true, true},
+		{"sub/build", true, true},
+		{"build", false, false}, // a file, not a directory
+		{"top.txt", false, true},
+		{"sub/top.txt", false, false}, // anchored to the root
+		{"docs/a.tmp", false, true},
+		{"docs/x/y/a.tmp", false, true},
+		{"other/a.tmp", false, false},
+		{"#hash", false, true},
+		{"sub/a.bak", false, true},
+		{"a.bak", false, false}, // sub's rules don't reach its parent
+		{"..cache/a.log", false, true},
+	}
+	for _, tt := range tests {
+		g := newGitignore(dir)
+		g.load(filepath.Join(dir, "sub"))
+		if got := g.ignored(filepath.Join(dir, filepath.FromSlash(tt.path)), tt.isDir); got != tt.want {
+			t.Errorf("ignored(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+
+	// Paths outside the rules' directory are left alone.
+	g := newGitignore(filepath.Join(dir, "sub"))
+	if g.ignored(filepath.Join(dir, "a.bak"), false) {
+		t.Error("sub/.gitignore applies to its parent")
+	}
+}
+
+func TestGitignoreWithoutRepository(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".gitignore":     "*.log\n",
+		"sub/.gitignore": "*.bak\n",
+	})
+	// Outside a repository only the directory's own .gitignore is read.
+	g := newGitignore(filepath.Join(dir, "sub"))
+	if g.ignored(filepath.Join(dir, "sub", "a.log"), false) {
+		t.Error("the parent's .gitignore applies outside a repository")
+	}
+	if !g.ignored(filepath.Join(dir, "sub", "a.bak"), false) {
+		t.Error("the directory's own .gitignore doesn't apply")
+	}
+}
+
+func TestWalkDir(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".git/HEAD":        "",
+		".gitignore":       "*.log\nvendor/\n",
+		"main.go":          "",
+		"debug.log":        "",
+		"vendor/dep.go":    "",
+		"pkg/a.go":         "",
+		"pkg/.gitignore":   "gen_*.go\n!gen_keep.go\n",
+		"pkg/gen_x.go":     "",
+		"pkg/gen_keep.go":  "",
+		"pkg/sub/gen_y.go": "",
+	})
+	files, err := walkDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(dir, f)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	want := []string{".gitignore", "main.go", "pkg/.gitignore", "pkg/a.go", "pkg/gen_keep.go"}
+	if !slices.Equal(got, want) {
+		t.Errorf("walkDir() = %q, want %q", got, want)
+	}
+}
+
+func TestExpandInputPathsGlob(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".git/HEAD":          "",
+		".gitignore":         "vendor/\n",
+		"main.go":            "",
+		"pkg/a.go":           "",
+		"pkg/.gitignore":     "gen/\n",
+		"pkg/gen/x.go":       "",
+		"vendor/dep.go":      "",
+		"vendor/lib/dep.go":  "",
+		"vendor/lib/more.go": "",
+	})
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*/*.go", []string{"pkg/a.go"}},
+		{"vendor/*.go", nil},
+		{"vendor/*/*.go", nil}, // in a subdirectory of an ignored one
+		{"vendor/*", nil},      // a directory under an ignored one isn't walked
+		{"pkg/gen/*.go", nil},  // ignored by a nested .gitignore
+		{".git/*", nil},        // .git is always skipped
+		{"*.go", []string{"main.go"}},
+	}
+	for _, tt := range tests {
+		paths, err := expandInputPaths([]string{filepath.Join(dir, tt.pattern)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, p := range paths {
+			rel, _ := filepath.Rel(dir, p.path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("expandInputPaths(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"empty", nil, false},
+		{"text", []byte("package main\n"), false},
+		{"utf-8", []byte("héllo wörld"), false},
+		{"latin-1", []byte("h\xe9llo"), false},
+		{"nul", []byte("PK\x03\x04\x00\x00"), true},
+		{"nul past the sniffed part", append([]byte(strings.Repeat("a", binarySniffLen)), 0), false},
+	}
+	for _, tt := range tests {
+		if got := isBinary(tt.data); got != tt.want {
+			t.Errorf("isBinary(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
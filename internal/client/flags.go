@@ -0,0 +1,46 @@
+package client
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/cpcf/meh/pkg/meh"
+)
+
+// OptionFlags defines a flag on fs for each generation option, parsing it
+// into options. usage is a format for the flag's usage, given its name.
+func OptionFlags(fs *flag.FlagSet, options meh.Options, usage string) {
+	for _, name := range meh.OptionNames() {
+		fs.Var(optionValue{options: options, name: name}, name, fmt.Sprintf(usage, name))
+	}
+}
+
+// optionValue is a flag.Value that parses a generation option into options.
+// Repeating a list option such as -stop adds to it, and an empty value
+// removes the option.
+type optionValue struct {
+	options meh.Options
+	name    string
+}
+
+func (v optionValue) String() string {
+	return v.options.Value(v.name)
+}
+
+func (v optionValue) Set(s string) error {
+	val, err := meh.ParseOption(v.name, s)
+	if err != nil {
+		return err
+	}
+	if val == nil {
+		delete(v.options, v.name)
+		return nil
+	}
+	if prev, ok := v.options[v.name].([]string); ok {
+		if next, ok := val.([]string); ok {
+			val = append(prev, next...)
+		}
+	}
+	v.options[v.name] = val
+	return nil
+}
@@ -0,0 +1,258 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cpcf/meh/internal/rag"
+	"github.com/cpcf/meh/pkg/meh"
+)
+
+const indexUsage = `Usage: meh [-p persona] index [-name name] [-model model] <dir>
+       meh index
+
+Split the text, Markdown and code files under dir into chunks, embed them
+with the persona's Ollama server and save them as an index to search with -r.
+Files excluded by .gitignore and binary files are skipped. Indexing a
+directory again replaces its index. Without a directory, list the indexes.
+
+Flags:
+  -name name      Name of the index (default: the directory's name)
+  -model model    Embedding model (default: ` + defaultEmbedModel + `)`
+
+// defaultEmbedModel embeds indexes when no model is given.
+const defaultEmbedModel = "nomic-embed-text"
+
+// defaultChunks is how many chunks of an index are added to a question.
+const defaultChunks = 4
+
+// maxIndexFileSize is the size above which files are left out of an index,
+// as they are more likely data than text worth searching.
+const maxIndexFileSize = 1 << 20
+
+// runIndex implements meh index.
+func runIndex(ctx context.Context, conf *meh.Config, persona meh.Persona, args []string) error {
+	fs := flag.NewFlagSet("index", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	name := fs.String("name", "", "")
+	model := fs.String("model", defaultEmbedModel, "")
+	if err := fs.Parse(args); err != nil {
+		return UsageError(indexUsage)
+	}
+	switch fs.NArg() {
+	case 0:
+		return listIndexes()
+	case 1:
+	default:
+		return UsageError(indexUsage)
+	}
+	if err := needPersona(persona); err != nil {
+		return err
+	}
+	embedder, err := newEmbedder(persona)
+	if err != nil {
+		return err
+	}
+	dir := fs.Arg(0)
+	if *name == "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		*name = filepath.Base(abs)
+	}
+	idx, err := buildIndex(ctx, embedder, *name, dir, *model)
+	if err != nil {
+		return err
+	}
+	path, err := indexPath(idx.Name)
+	if err != nil {
+		return err
+	}
+	if err := idx.Save(path); err != nil {
+		return err
+	}
+	fmt.Printf("indexed %d chunks of %s as %s\n", len(idx.Chunks), dir, idx.Name)
+	return nil
+}
+
+// newEmbedder returns the persona's API if it can embed text.
+func newEmbedder(persona meh.Persona) (meh.Embedder, error) {
+	api, err := meh.NewAPI(persona)
+	if err != nil {
+		return nil, err
+	}
+	embedder, ok := api.(meh.Embedder)
+	if !ok {
+		return nil, fmt.Errorf("provider %q does not support embeddings", persona.Provider)
+	}
+	return embedder, nil
+}
+
+// buildIndex splits the files under dir into chunks and embeds them with
+// model, reporting its progress on stderr.
+func buildIndex(ctx context.Context, embedder meh.Embedder, name, dir, model string) (*rag.Index, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	files, err := walkDir(root)
+	if err != nil {
+		return nil, err
+	}
+	idx := &rag.Index{Name: name, Root: root, Model: model, Created: time.Now()}
+	for i, path := range files {
+		if info, err := os.Stat(path); err != nil || info.Size() > maxIndexFileSize {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading file: %w", err)
+		}
+		if isBinary(data) {
+			continue
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil, err
+		}
+		chunks := rag.Split(rel, string(data))
+		if len(chunks) == 0 {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "\r\033[K[%d/%d] %s", i+1, len(files), rel)
+		texts := make([]string, len(chunks))
+		for j, c := range chunks {
+			texts[j] = c.Text
+		}
+		vectors, err := embedder.Embed(ctx, model, texts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr)
+			return nil, fmt.Errorf("%s: %w", rel, err)
+		}
+		for j := range chunks {
+			rag.Normalize(vectors[j])
+			chunks[j].Vector = vectors[j]
+		}
+		idx.Chunks = append(idx.Chunks, chunks...)
+	}
+	fmt.Fprint(os.Stderr, "\r\033[K")
+	if len(idx.Chunks) == 0 {
+		return nil, fmt.Errorf("no text files to index in %s", dir)
+	}
+	return idx, nil
+}
+
+func indexesDir() (string, error) {
+	dir, err := meh.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "indexes"), nil
+}
+
+// indexPath returns the path of the file the index called name is saved in.
+func indexPath(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid index name %q", name)
+	}
+	dir, err := indexesDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".idx"), nil
+}
+
+// loadIndex reads the index called name.
+func loadIndex(name string) (*rag.Index, error) {
+	path, err := indexPath(name)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := rag.Load(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no index named %q, create one with meh index <dir>", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("index %s: %w", name, err)
+	}
+	return idx, nil
+}
+
+// listIndexes prints the saved indexes.
+func listIndexes() error {
+	dir, err := indexesDir()
+	if err != nil {
+		return err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.idx"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCHUNKS\tMODEL\tCREATED\tDIRECTORY")
+	for _, path := range paths {
+		idx, err := rag.Load(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", idx.Name, len(idx.Chunks), idx.Model, idx.Created.Format("2006-01-02 15:04"), idx.Root)
+	}
+	return w.Flush()
+}
+
+// searchIndex returns the k chunks of idx most relevant to query, embedding
+// it with the index's model.
+func searchIndex(ctx context.Context, api meh.API, idx *rag.Index, query string, k int) ([]rag.Result, error) {
+	embedder, ok := api.(meh.Embedder)
+	if !ok {
+		return nil, errors.New("the persona's provider does not support embeddings")
+	}
+	vectors, err := embedder.Embed(ctx, idx.Model, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("error searching index %s: %w", idx.Name, err)
+	}
+	return idx.Search(vectors[0], k), nil
+}
+
+// retrievalPrompt adds the chunks found for query to it, numbered so the
+// reply can cite them.
+func retrievalPrompt(query string, results []rag.Result) string {
+	if len(results) == 0 {
+		return query
+	}
+	var b strings.Builder
+	b.WriteString("Answer the question using these excerpts where they are relevant. Cite the excerpts you use by their numbers, like [1].\n\n")
+	for i, r := range results {
+		fmt.Fprintf(&b, "[%d] %s\n%s\n\n", i+1, r.Source(), codeFence(filepath.Ext(r.Path), r.Text))
+	}
+	b.WriteString("Question: ")
+	b.WriteString(query)
+	return b.String()
+}
+
+// sourceList lists the sources of results by their citation numbers.
+func sourceList(results []rag.Result) string {
+	sources := make([]string, len(results))
+	for i, r := range results {
+		sources[i] = fmt.Sprintf("[%d] %s", i+1, r.Source())
+	}
+	return strings.Join(sources, ", ")
+}
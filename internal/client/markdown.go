@@ -0,0 +1,218 @@
+package client
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/glamour/styles"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"golang.org/x/term"
+)
+
+// newMarkdownRenderer returns a renderer for replies that wraps them at width
+// and highlights fenced code, styled for the terminal's background.
+func newMarkdownRenderer(width int) (*glamour.TermRenderer, error) {
+	style := styles.LightStyle
+	if lipgloss.HasDarkBackground() {
+		style = styles.DarkStyle
+	}
+	return glamour.NewTermRenderer(
+		glamour.WithStandardStyle(style),
+		glamour.WithColorProfile(lipgloss.ColorProfile()),
+		glamour.WithWordWrap(width),
+	)
+}
+
+// renderMarkdown renders text with r, trimming the blank lines the renderer
+// puts around the document. If rendering fails the text is returned as is.
+func renderMarkdown(r *glamour.TermRenderer, text string) string {
+	out, err := r.Render(text)
+	if err != nil {
+		return text
+	}
+	out = trimBlankLines(out)
+	if strings.Contains(out, "\x1b[") {
+		// The trimmed lines may have held the sequence ending the last style.
+		out += ansi.ResetStyle
+	}
+	return out
+}
+
+// trimBlankLines removes leading and trailing lines holding nothing but
+// spaces and escape sequences.
+func trimBlankLines(s string) string {
+	lines := strings.Split(s, "\n")
+	blank := func(line string) bool { return strings.TrimSpace(ansi.Strip(line)) == "" }
+	for len(lines) > 0 && blank(lines[0]) {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && blank(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// replyOutput returns where command-line replies are printed: stdout,
+// rendering markdown as it streams in unless raw is set or stdout is not a
+// terminal.
+func replyOutput(raw bool) io.Writer {
+	fd := int(os.Stdout.Fd())
+	if raw || !term.IsTerminal(fd) {
+		return os.Stdout
+	}
+	width, _, err := term.GetSize(fd)
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	r, err := newMarkdownRenderer(width)
+	if err != nil {
+		return os.Stdout
+	}
+	return &markdownWriter{w: os.Stdout, r: r}
+}
+
+// markdownWriter renders streamed markdown to w a block at a time. Text is
+// held back until the block it belongs to ends, at a blank line or the end of
+// a fenced code block, since a partial block can render differently once the
+// rest arrives. Like the raw reply, the output doesn't end in a newline.
+type markdownWriter struct {
+	w       io.Writer
+	r       *glamour.TermRenderer
+	pending string // text of the unfinished block
+	scanned int    // length of pending already scanned for block ends
+	fence   string // the marker of the open code fence, if any
+	printed bool
+}
+
+func (m *markdownWriter) Write(p []byte) (int, error) {
+	m.pending += string(p)
+	for {
+		i := strings.IndexByte(m.pending[m.scanned:], '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := m.pending[m.scanned : m.scanned+i]
+		m.scanned += i + 1
+		if m.endsBlock(line) {
+			if err := m.emit(m.pending[:m.scanned]); err != nil {
+				return len(p), err
+			}
+			m.pending, m.scanned = m.pending[m.scanned:], 0
+		}
+	}
+}
+
+// endsBlock tracks code fences through line and reports whether the text up
+// to and including it can be rendered on its own.
+func (m *markdownWriter) endsBlock(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	if m.fence != "" {
+		if closesFence(trimmed, m.fence) {
+			m.fence = ""
+			return true
+		}
+		return false
+	}
+	if marker := fenceMarker(trimmed); marker != "" {
+		m.fence = marker
+		return false
+	}
+	return trimmed == ""
+}
+
+// fenceMarker returns the run of backticks or tildes opening a code fence on
+// line, or "" if line doesn't open one.
+func fenceMarker(line string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n >= 3 {
+			return line[:n]
+		}
+	}
+	return ""
+}
+
+// closesFence reports whether line closes the code fence opened by marker.
+func closesFence(line, marker string) bool {
+	return strings.HasPrefix(line, marker) && strings.Trim(line, marker[:1]) == ""
+}
+
+// emit renders a finished block, separating it from the previous one.
+func (m *markdownWriter) emit(block string) error {
+	if strings.TrimSpace(block) == "" {
+		return nil
+	}
+	out := renderMarkdown(m.r, block)
+	if m.printed {
+		out = "\n\n" + out
+	}
+	m.printed = true
+	_, err := io.WriteString(m.w, out)
+	return err
+}
+
+// Flush renders whatever is left of the reply, leaving m ready for the next.
+func (m *markdownWriter) Flush() error {
+	block := m.pending
+	m.pending, m.scanned, m.fence = "", 0, ""
+	err := m.emit(block)
+	m.printed = false
+	return err
+}
+
+// flushReply renders any held back text, if out is a markdownWriter.
+func flushReply(out io.Writer) error {
+	if m, ok := out.(*markdownWriter); ok {
+		return m.Flush()
+	}
+	return nil
+}
+
+// codeBlock is a fenced code block in a reply.
+type codeBlock struct {
+	lang  string
+	code  string
+	start int // offset of the opening fence in the reply
+}
+
+// codeBlocks returns the fenced code blocks in text, in order. A block whose
+// closing fence is missing, as while it streams in, runs to the end of text.
+func codeBlocks(text string) []codeBlock {
+	var (
+		blocks []codeBlock
+		block  *codeBlock
+		fence  string
+		indent string
+		code   strings.Builder
+	)
+	for offset := 0; offset < len(text); {
+		line, _, _ := strings.Cut(text[offset:], "\n")
+		start := offset
+		offset += len(line) + 1
+		trimmed := strings.TrimSpace(line)
+		if block == nil {
+			if fence = fenceMarker(trimmed); fence != "" {
+				block = &codeBlock{lang: strings.TrimSpace(trimmed[len(fence):]), start: start}
+				indent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+				code.Reset()
+			}
+			continue
+		}
+		if closesFence(trimmed, fence) {
+			block.code = code.String()
+			blocks = append(blocks, *block)
+			block = nil
+			continue
+		}
+		code.WriteString(strings.TrimPrefix(line, indent))
+		code.WriteByte('\n')
+	}
+	if block != nil {
+		block.code = code.String()
+		blocks = append(blocks, *block)
+	}
+	return blocks
+}
@@ -0,0 +1,307 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/cpcf/meh/pkg/meh"
+)
+
+type modelItem struct {
+	info   meh.ModelInfo
+	loaded bool
+}
+
+func (i modelItem) Title() string {
+	if i.loaded {
+		return i.info.Name + " (loaded)"
+	}
+	return i.info.Name
+}
+func (i modelItem) Description() string {
+	d := i.info.Details
+	return fmt.Sprintf("%s - %s - %s - %s", formatSize(i.info.Size), d.Family, d.QuantizationLevel, i.info.ModifiedAt.Local().Format("2006-01-02 15:04"))
+}
+func (i modelItem) FilterValue() string { return i.info.Name }
+
+// modelsLoadedMsg carries the installed models, and those loaded in memory.
+type modelsLoadedMsg struct {
+	models  []meh.ModelInfo
+	running []meh.RunningModel
+	err     error
+}
+
+// pullProgressMsg carries the next update from a pull.
+type pullProgressMsg meh.PullProgress
+
+// pullDoneMsg reports the outcome of a pull.
+type pullDoneMsg struct{ err error }
+
+// modelDeletedMsg reports the outcome of deleting a model.
+type modelDeletedMsg struct{ err error }
+
+func loadModels(api meh.ModelManager) tea.Cmd {
+	return func() tea.Msg {
+		ctx := context.Background()
+		models, err := api.ListModels(ctx)
+		if err != nil {
+			return modelsLoadedMsg{err: err}
+		}
+		// Which models are loaded is a nicety, older servers lack /ps.
+		running, _ := api.Running(ctx)
+		return modelsLoadedMsg{models: models, running: running}
+	}
+}
+
+// waitForPull reads the next update from a pull without blocking Update,
+// and its outcome once progress is closed.
+func waitForPull(progress chan meh.PullProgress, errc chan error) tea.Cmd {
+	return func() tea.Msg {
+		p, ok := <-progress
+		if !ok {
+			return pullDoneMsg{err: <-errc}
+		}
+		return pullProgressMsg(p)
+	}
+}
+
+func deleteModel(api meh.ModelManager, model string) tea.Cmd {
+	return func() tea.Msg {
+		return modelDeletedMsg{err: api.Delete(context.Background(), model)}
+	}
+}
+
+// ModelManagerModel lists the models on the persona's Ollama server and lets
+// the user pull new ones and delete old ones.
+type ModelManagerModel struct {
+	api      meh.ModelManager
+	list     list.Model
+	input    textinput.Model
+	progress progress.Model
+	naming   bool // entering the name of a model to pull
+	deleting bool
+	pulling  string // the model being pulled, if any
+	status   meh.PullProgress
+	updates  chan meh.PullProgress
+	errc     chan error
+	cancel   context.CancelFunc
+	notice   string
+	width    int
+	height   int
+	styles   *Styles
+	lg       *lipgloss.Renderer
+	err      error
+}
+
+func NewModelManagerModel(persona meh.Persona) ModelManagerModel {
+	lg := lipgloss.DefaultRenderer()
+	s := NewStyles(lg)
+
+	l := list.New(nil, list.NewDefaultDelegate(), 0, 0)
+	l.SetShowHelp(false)
+	l.Title = "Models"
+
+	ti := textinput.New()
+	ti.Prompt = "Pull: "
+	ti.Placeholder = "llama3.2"
+
+	api, err := modelsAPI(persona)
+	return ModelManagerModel{
+		api:      api,
+		list:     l,
+		input:    ti,
+		progress: progress.New(progress.WithDefaultGradient()),
+		lg:       lg,
+		styles:   s,
+		err:      err,
+	}
+}
+
+func (m ModelManagerModel) Init() tea.Cmd {
+	if m.api == nil {
+		return tea.WindowSize()
+	}
+	return tea.Batch(tea.WindowSize(), loadModels(m.api))
+}
+
+func (m ModelManagerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		UpdateWidth(&m, msg.Width)
+		h, v := m.styles.Base.GetFrameSize()
+		m.height = msg.Height - v
+		m.list.SetSize(min(msg.Width-h, maxWidth), msg.Height-v-listVerticalOffset)
+		m.progress.Width = min(msg.Width-h, 60)
+	case modelsLoadedMsg:
+		m.err = msg.err
+		loaded := make(map[string]bool)
+		for _, r := range msg.running {
+			loaded[r.Name] = true
+		}
+		sort.Slice(msg.models, func(i, j int) bool { return msg.models[i].Name < msg.models[j].Name })
+		items := make([]list.Item, len(msg.models))
+		for i, info := range msg.models {
+			items[i] = modelItem{info: info, loaded: loaded[info.Name]}
+		}
+		return m, m.list.SetItems(items)
+	case pullProgressMsg:
+		m.status = meh.PullProgress(msg)
+		return m, waitForPull(m.updates, m.errc)
+	case pullDoneMsg:
+		if msg.err != nil && msg.err != context.Canceled {
+			m.err = fmt.Errorf("pulling %s: %w", m.pulling, msg.err)
+		} else if msg.err == nil {
+			m.notice = "Pulled " + m.pulling
+		}
+		m.stopPull()
+		return m, loadModels(m.api)
+	case modelDeletedMsg:
+		m.err = msg.err
+		return m, loadModels(m.api)
+	case tea.KeyMsg:
+		switch {
+		case m.api == nil:
+			return m, BackToMain
+		case m.pulling != "":
+			if msg.String() == "esc" || msg.String() == "ctrl+c" {
+				m.cancel()
+			}
+			return m, nil
+		case m.naming:
+			return m.updatePull(msg)
+		case m.deleting:
+			return m.updateDelete(msg)
+		case m.list.FilterState() == list.Filtering:
+			break
+		default:
+			m.err, m.notice = nil, ""
+			switch msg.String() {
+			case "esc", "ctrl+c", "q":
+				return m, BackToMain
+			case "p":
+				m.naming = true
+				m.input.Reset()
+				return m, m.input.Focus()
+			case "d":
+				if _, ok := m.list.SelectedItem().(modelItem); ok {
+					m.deleting = true
+				}
+				return m, nil
+			case "r":
+				return m, loadModels(m.api)
+			}
+		}
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m ModelManagerModel) updatePull(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.naming = false
+		m.input.Blur()
+		return m, nil
+	case "enter":
+		m.naming = false
+		m.input.Blur()
+		name := strings.TrimSpace(m.input.Value())
+		if name == "" {
+			return m, nil
+		}
+		var ctx context.Context
+		ctx, m.cancel = context.WithCancel(context.Background())
+		m.pulling = name
+		m.status = meh.PullProgress{Status: "starting"}
+		m.updates = make(chan meh.PullProgress)
+		m.errc = make(chan error, 1)
+		api, updates, errc := m.api, m.updates, m.errc
+		go func() { errc <- api.Pull(ctx, name, updates) }()
+		return m, waitForPull(m.updates, m.errc)
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m ModelManagerModel) updateDelete(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.deleting = false
+	if msg.String() != "y" {
+		return m, nil
+	}
+	if selected, ok := m.list.SelectedItem().(modelItem); ok {
+		return m, deleteModel(m.api, selected.info.Name)
+	}
+	return m, nil
+}
+
+// stopPull forgets the finished pull.
+func (m *ModelManagerModel) stopPull() {
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+	m.pulling = ""
+	m.updates, m.errc = nil, nil
+}
+
+func (m ModelManagerModel) View() string {
+	s := m.styles
+	body := s.Base.Render(m.list.View())
+
+	header := appBoundaryView(&m, "manage models")
+	footer := appBoundaryView(&m, "p pull • d delete • r refresh • / filter • esc back")
+	switch {
+	case m.err != nil:
+		header = appErrorBoundaryView(&m, m.err.Error())
+	case m.notice != "":
+		header = appBoundaryView(&m, m.notice)
+	}
+	switch {
+	case m.api == nil:
+		footer = appBoundaryView(&m, "press any key to return")
+	case m.pulling != "":
+		line := fmt.Sprintf("Pulling %s: %s", m.pulling, m.status.Status)
+		if m.status.Total > 0 {
+			percent := float64(m.status.Completed) / float64(m.status.Total)
+			line += "\n" + m.progress.ViewAs(percent) + " " +
+				fmt.Sprintf("%s/%s", formatSize(m.status.Completed), formatSize(m.status.Total))
+		}
+		footer = line + "\n" + appBoundaryView(&m, "esc cancel")
+	case m.naming:
+		footer = appBoundaryView(&m, m.input.View())
+	case m.deleting:
+		if selected, ok := m.list.SelectedItem().(modelItem); ok {
+			footer = appErrorBoundaryView(&m, fmt.Sprintf("Delete %s? (y/n)", selected.info.Name))
+		}
+	}
+
+	return s.Base.Render(header + "\n" + body + "\n\n" + footer)
+}
+
+func (m ModelManagerModel) Height() int {
+	return m.height
+}
+func (m ModelManagerModel) Width() int {
+	return m.width
+}
+
+func (m *ModelManagerModel) SetHeight(height int) {
+	m.height = height
+}
+func (m *ModelManagerModel) SetWidth(width int) {
+	m.width = width
+}
+
+func (m ModelManagerModel) Styles() *Styles {
+	return m.styles
+}
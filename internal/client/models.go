@@ -0,0 +1,193 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cpcf/meh/pkg/meh"
+)
+
+const modelsUsage = `Usage: meh [-p persona] models <command>
+
+Manage the models on the persona's Ollama server.
+
+Commands:
+  list                    List local models
+  pull <model>            Download a model
+  show <model>            Show a model's details
+  rm <model>...           Delete models
+  cp <source> <target>    Copy a model under a new name
+  ps                      List the models loaded in memory`
+
+// runModels implements meh models.
+func runModels(ctx context.Context, conf *meh.Config, persona meh.Persona, args []string) error {
+	if len(args) == 0 {
+		return UsageError(modelsUsage)
+	}
+	api, err := modelsAPI(persona)
+	if err != nil {
+		return err
+	}
+
+	switch name, args := args[0], args[1:]; {
+	case name == "list" || name == "ls":
+		return listModels(ctx, api)
+	case name == "ps":
+		return listRunning(ctx, api)
+	case name == "pull" && len(args) == 1:
+		return pullModel(ctx, api, args[0])
+	case name == "show" && len(args) == 1:
+		return showModel(ctx, api, args[0])
+	case name == "rm" && len(args) > 0:
+		for _, model := range args {
+			if err := api.Delete(ctx, model); err != nil {
+				return fmt.Errorf("%s: %w", model, err)
+			}
+			fmt.Printf("deleted %s\n", model)
+		}
+		return nil
+	case name == "cp" && len(args) == 2:
+		if err := api.Copy(ctx, args[0], args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("copied %s to %s\n", args[0], args[1])
+		return nil
+	}
+	return UsageError(modelsUsage)
+}
+
+// modelsAPI returns a manager of the models on the persona's server.
+func modelsAPI(persona meh.Persona) (meh.ModelManager, error) {
+	if err := needPersona(persona); err != nil {
+		return nil, err
+	}
+	return meh.NewModelManager(persona)
+}
+
+func listModels(ctx context.Context, api meh.ModelManager) error {
+	models, err := api.ListModels(ctx)
+	if err != nil {
+		return err
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].Name < models[j].Name })
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tID\tSIZE\tMODIFIED")
+	for _, m := range models {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.Name, shortDigest(m.Digest), formatSize(m.Size), m.ModifiedAt.Local().Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+func listRunning(ctx context.Context, api meh.ModelManager) error {
+	models, err := api.Running(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSIZE\tPROCESSOR\tUNTIL")
+	for _, m := range models {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.Name, formatSize(m.Size), processor(m), m.ExpiresAt.Local().Format("2006-01-02 15:04:05"))
+	}
+	return w.Flush()
+}
+
+// processor describes how much of a loaded model is on the GPU.
+func processor(m meh.RunningModel) string {
+	switch {
+	case m.Size == 0 || m.SizeVRAM == 0:
+		return "100% CPU"
+	case m.SizeVRAM >= m.Size:
+		return "100% GPU"
+	}
+	gpu := int(float64(m.SizeVRAM) / float64(m.Size) * 100)
+	return fmt.Sprintf("%d%%/%d%% CPU/GPU", 100-gpu, gpu)
+}
+
+func showModel(ctx context.Context, api meh.ModelManager, model string) error {
+	info, err := api.Show(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "Model")
+	arch, _ := info.ModelInfo["general.architecture"].(string)
+	for _, row := range [][2]string{
+		{"architecture", arch},
+		{"parameters", info.Details.ParameterSize},
+		{"context length", fmt.Sprint(info.ModelInfo[arch+".context_length"])},
+		{"quantization", info.Details.QuantizationLevel},
+	} {
+		if row[1] != "" && row[1] != "<nil>" {
+			fmt.Fprintf(w, "  %s\t%s\n", row[0], row[1])
+		}
+	}
+	section := func(title, body string) {
+		body = strings.TrimSpace(body)
+		if body == "" {
+			return
+		}
+		fmt.Fprintf(w, "\n%s\n", title)
+		for _, line := range strings.Split(body, "\n") {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+	section("Capabilities", strings.Join(info.Capabilities, "\n"))
+	section("Parameters", info.Parameters)
+	if license, _, _ := strings.Cut(strings.TrimSpace(info.License), "\n"); license != "" {
+		section("License", license)
+	}
+	return w.Flush()
+}
+
+// pullModel downloads a model, drawing a progress bar for each layer on
+// stderr.
+func pullModel(ctx context.Context, api meh.ModelManager, model string) error {
+	progress := make(chan meh.PullProgress)
+	errc := make(chan error, 1)
+	go func() { errc <- api.Pull(ctx, model, progress) }()
+
+	var last string
+	for p := range progress {
+		if p.Status != last && last != "" {
+			fmt.Fprintln(os.Stderr)
+		}
+		last = p.Status
+		if p.Total > 0 {
+			fmt.Fprintf(os.Stderr, "\r%s %s", p.Status, progressBar(p.Completed, p.Total, 30))
+		} else {
+			fmt.Fprintf(os.Stderr, "\r%s", p.Status)
+		}
+	}
+	if last != "" {
+		fmt.Fprintln(os.Stderr)
+	}
+	return <-errc
+}
+
+// progressBar draws completed out of total as a bar width cells wide,
+// followed by the percentage and sizes.
+func progressBar(completed, total int64, width int) string {
+	frac := float64(completed) / float64(total)
+	if frac > 1 {
+		frac = 1
+	}
+	filled := int(frac * float64(width))
+	return fmt.Sprintf("[%s%s] %3.0f%% %s/%s", strings.Repeat("█", filled), strings.Repeat(" ", width-filled),
+		frac*100, formatSize(completed), formatSize(total))
+}
+
+// shortDigest abbreviates a model digest as Ollama does.
+func shortDigest(digest string) string {
+	digest = strings.TrimPrefix(digest, "sha256:")
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
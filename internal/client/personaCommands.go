@@ -0,0 +1,260 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cpcf/meh/pkg/meh"
+	"gopkg.in/yaml.v2"
+)
+
+const personaUsage = `Usage: meh persona <command>
+
+Manage the personas in the config file.
+
+Commands:
+  list                    List the personas
+  show <name>             Print a persona's settings
+  add <name> [flags]      Add a persona
+  edit <name> [flags]     Change a persona's settings
+  rm <name>               Delete a persona
+  default [name]          Show or set the default persona
+
+Flags for add and edit:
+`
+
+// runPersona implements meh persona.
+func runPersona(ctx context.Context, conf *meh.Config, _ meh.Persona, args []string) error {
+	if len(args) == 0 {
+		return personaUsageError()
+	}
+	switch name, args := args[0], args[1:]; {
+	case name == "list" || name == "ls":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "NAME\tPROVIDER\tMODEL\tURL")
+		for _, p := range conf.Personas {
+			title := p.Name
+			if p.Name == conf.DefaultPersona {
+				title += " (default)"
+			}
+			provider := p.Provider
+			if provider == "" {
+				provider = meh.DefaultProvider
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", title, provider, p.Model, p.APIURL)
+		}
+		return w.Flush()
+	case name == "show" && len(args) == 1:
+		p, ok := conf.FindPersona(args[0])
+		if !ok {
+			return fmt.Errorf("no persona named %q", args[0])
+		}
+		data, err := yaml.Marshal(p)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	case name == "add" || name == "edit":
+		return editPersona(conf, name == "add", args)
+	case name == "rm" && len(args) == 1:
+		if err := conf.RemovePersona(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("deleted %s\n", args[0])
+		return nil
+	case name == "default" && len(args) == 0:
+		if conf.DefaultPersona == "" {
+			return fmt.Errorf("no default persona")
+		}
+		fmt.Println(conf.DefaultPersona)
+		return nil
+	case name == "default" && len(args) == 1:
+		return conf.SetDefaultPersona(args[0])
+	}
+	return personaUsageError()
+}
+
+// personaFlags holds the flags of meh persona add and edit.
+type personaFlags struct {
+	fs                   *flag.FlagSet
+	provider, url, model *string
+	system, format       *string
+	schema, tools, cmds  *string
+	context, name        *string
+	setDefault           *bool
+	options              meh.Options
+}
+
+func newPersonaFlags() *personaFlags {
+	fs := flag.NewFlagSet("persona", flag.ContinueOnError)
+	fs.SetOutput(new(bytes.Buffer)) // errors are reported with the usage
+	f := &personaFlags{
+		fs:         fs,
+		provider:   fs.String("provider", "", "Backend API: "+strings.Join(meh.ProviderNames(), ", ")),
+		url:        fs.String("url", "", "API URL"),
+		model:      fs.String("model", "", "Model"),
+		system:     fs.String("system", "", "System prompt"),
+		format:     fs.String("format", "", "Constrain replies to a format (json)"),
+		schema:     fs.String("schema", "", "JSON schema file replies must match"),
+		tools:      fs.String("tools", "", "Comma separated built-in tools the model may call"),
+		cmds:       fs.String("commands", "", "Comma separated programs run_command may run"),
+		context:    fs.String("context", "", "What to send once a chat outgrows num_ctx: "+strings.Join(meh.ContextStrategies(), ", ")),
+		name:       fs.String("name", "", "Rename the persona (edit only)"),
+		setDefault: fs.Bool("default", false, "Make it the default persona"),
+		options:    meh.Options{},
+	}
+	OptionFlags(fs, f.options, "Generation option %s, empty to remove it")
+	return f
+}
+
+// parse reads the persona's name and flags, which may come before or after
+// the name.
+func (f *personaFlags) parse(args []string) (string, error) {
+	if err := f.fs.Parse(args); err != nil {
+		return "", err
+	}
+	if f.fs.NArg() == 0 {
+		return "", fmt.Errorf("missing persona name")
+	}
+	name := f.fs.Arg(0)
+	if err := f.fs.Parse(f.fs.Args()[1:]); err != nil {
+		return "", err
+	}
+	if f.fs.NArg() > 0 {
+		return "", fmt.Errorf("unexpected argument %q", f.fs.Arg(0))
+	}
+	return name, nil
+}
+
+// apply sets the flags given on the command line in p.
+func (f *personaFlags) apply(p meh.Persona) (meh.Persona, bool) {
+	setDefault := false
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "provider":
+			p.Provider = *f.provider
+		case "url":
+			p.APIURL = *f.url
+		case "model":
+			p.Model = *f.model
+		case "system":
+			p.SystemPrompt = *f.system
+		case "format":
+			p.Format = *f.format
+		case "schema":
+			p.Schema = absPath(*f.schema)
+		case "tools":
+			p.Tools = splitList(*f.tools)
+		case "commands":
+			p.Commands = splitList(*f.cmds)
+		case "context":
+			p.Context = *f.context
+		case "name":
+			p.Name = *f.name
+		case "default":
+			setDefault = *f.setDefault
+		}
+	})
+	return p, setDefault
+}
+
+// editPersona implements meh persona add and edit, applying the same checks
+// as the persona form.
+func editPersona(conf *meh.Config, add bool, args []string) error {
+	f := newPersonaFlags()
+	name, err := f.parse(args)
+	if err != nil {
+		return personaUsageError(err)
+	}
+
+	original := ""
+	persona := meh.Persona{Name: name}
+	if !add {
+		var ok bool
+		if persona, ok = conf.FindPersona(name); !ok {
+			return fmt.Errorf("no persona named %q", name)
+		}
+		original = name
+		// Option flags change the persona's options rather than replace them.
+		for k, v := range persona.Options {
+			if !flagGiven(f.fs, k) {
+				f.options[k] = v
+			}
+		}
+	} else if *f.name != "" {
+		return personaUsageError(fmt.Errorf("-name only applies to edit"))
+	}
+	persona, setDefault := f.apply(persona)
+	if !add && !flagGiven(f.fs, "default") {
+		setDefault = conf.DefaultPersona == name
+	}
+	persona.Options = nil
+	if len(f.options) > 0 {
+		persona.Options = f.options
+	}
+
+	if err := conf.ValidatePersona(persona, original); err != nil {
+		return err
+	}
+	if add {
+		err = conf.AddPersona(persona, setDefault)
+	} else {
+		err = conf.UpdatePersona(original, persona, setDefault)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("saved %s\n", persona.Name)
+	return nil
+}
+
+func personaUsageError(errs ...error) error {
+	var b strings.Builder
+	for _, err := range errs {
+		fmt.Fprintf(&b, "%v\n\n", err)
+	}
+	b.WriteString(personaUsage)
+	fs := newPersonaFlags().fs
+	fs.SetOutput(&b)
+	fs.PrintDefaults()
+	return UsageError(strings.TrimRight(b.String(), "\n"))
+}
+
+func flagGiven(fs *flag.FlagSet, name string) bool {
+	given := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+	return given
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// absPath makes path absolute so it doesn't depend on the working directory.
+func absPath(path string) string {
+	if path == "" {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
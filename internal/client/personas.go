@@ -6,64 +6,59 @@ import (
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/cpcf/meh/pkg/meh"
 )
 
-// Persona represents a user-defined persona that overrides API/model settings and may include a system prompt.
-type Persona struct {
-	Name         string `yaml:"name"`
-	APIURL       string `yaml:"api_url"`
-	Model        string `yaml:"model"`
-	SystemPrompt string `yaml:"system_prompt,omitempty"`
-}
-
-func (r Persona) String() string {
-	return fmt.Sprintf("Persona{Name: %s, APIURL: %s, Model: %s, SystemPrompt: %s}", r.Name, r.APIURL, r.Model, r.SystemPrompt)
-}
-
-// FindPersona searches for a persona by name.
-func FindPersona(conf Config, personaName string) (Persona, bool) {
-	for _, r := range conf.Personas {
-		if r.Name == personaName {
-			return r, true
-		}
-	}
-	return Persona{}, false
-}
-
 type item struct {
-	persona Persona
+	persona   meh.Persona
+	isDefault bool
 }
 
 const maxListWidth = 50
 const listVerticalOffset = 7
 
-func (i item) Title() string       { return i.persona.Name }
+func (i item) Title() string {
+	if i.isDefault {
+		return i.persona.Name + " (default)"
+	}
+	return i.persona.Name
+}
 func (i item) Description() string { return i.persona.APIURL + " - " + i.persona.Model }
 func (i item) FilterValue() string { return i.persona.Name }
 
+// editPersonaMsg asks the main model to open the persona form on a persona.
+type editPersonaMsg meh.Persona
+
 type SelectPersonaModel struct {
+	config         *meh.Config
 	list           list.Model
 	width          int
 	height         int
 	styles         *Styles
 	lg             *lipgloss.Renderer
-	currentPersona Persona
+	currentPersona meh.Persona
 	delegate       list.DefaultDelegate
+	deleting       bool
+	err            error
 }
 
-func NewPersonaListModel(personas []Persona, currentPersona Persona) SelectPersonaModel {
-	items := make([]list.Item, len(personas))
-	for i, persona := range personas {
-		items[i] = item{persona: persona}
-	}
+func NewPersonaListModel(c *meh.Config, currentPersona meh.Persona) SelectPersonaModel {
 	d := list.NewDefaultDelegate()
 	lg := lipgloss.DefaultRenderer()
 	s := NewStyles(lg)
 
-	l := list.New(items, d, 0, 0)
+	l := list.New(personaItems(c), d, 0, 0)
 	l.SetShowHelp(false)
 	l.Title = "Personas"
-	return SelectPersonaModel{list: l, lg: lg, styles: s, currentPersona: currentPersona}
+	return SelectPersonaModel{config: c, list: l, lg: lg, styles: s, currentPersona: currentPersona}
+}
+
+func personaItems(c *meh.Config) []list.Item {
+	items := make([]list.Item, len(c.Personas))
+	for i, persona := range c.Personas {
+		items[i] = item{persona: persona, isDefault: persona.Name == c.DefaultPersona}
+	}
+	return items
 }
 
 func (m SelectPersonaModel) Init() tea.Cmd {
@@ -74,17 +69,38 @@ func (m SelectPersonaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.deleting {
+			return m.updateDelete(msg)
+		}
+		if m.list.FilterState() == list.Filtering {
+			break
+		}
+		m.err = nil
+		item, ok := m.list.SelectedItem().(item)
 		switch msg.String() {
 		case "esc", "ctrl+c", "q":
 			return m, func() tea.Msg { return switchMsg(mainState) }
 		case "enter":
-			item, ok := m.list.SelectedItem().(item)
 			if !ok {
 				return m, nil
 			}
 			m.currentPersona = item.persona
 			cmds = append(cmds, SetPersonaCmd(item.persona))
 			cmds = append(cmds, func() tea.Msg { return switchMsg(mainState) })
+		case "e":
+			if ok {
+				return m, func() tea.Msg { return editPersonaMsg(item.persona) }
+			}
+			return m, nil
+		case "d":
+			m.deleting = ok
+			return m, nil
+		case "s":
+			if ok {
+				m.err = m.config.SetDefaultPersona(item.persona.Name)
+				return m, m.list.SetItems(personaItems(m.config))
+			}
+			return m, nil
 		}
 	case tea.WindowSizeMsg:
 		UpdateWidth(&m, msg.Width)
@@ -99,6 +115,23 @@ func (m SelectPersonaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+func (m SelectPersonaModel) updateDelete(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.deleting = false
+	selected, ok := m.list.SelectedItem().(item)
+	if msg.String() != "y" || !ok {
+		return m, nil
+	}
+	if m.err = m.config.RemovePersona(selected.persona.Name); m.err != nil {
+		return m, nil
+	}
+	cmd := m.list.SetItems(personaItems(m.config))
+	if selected.persona.Name == m.currentPersona.Name {
+		m.currentPersona = meh.Persona{}
+		return m, tea.Batch(cmd, SetPersonaCmd(m.currentPersona))
+	}
+	return m, cmd
+}
+
 func (m SelectPersonaModel) View() string {
 	s := m.styles
 	// List (left side)
@@ -109,7 +142,15 @@ func (m SelectPersonaModel) View() string {
 	status := CreateStatusBar(s, m.currentPersona, m.width-h-trueWidth(m.list), m.list.Height(), "Current Persona")
 	header := appBoundaryView(&m, "select a persona")
 	body := lipgloss.JoinHorizontal(lipgloss.Top, list, status)
-	footer := appBoundaryView(&m, m.list.Help.ShortHelpView(m.list.ShortHelp()))
+	footer := appBoundaryView(&m, "enter select • e edit • d delete • s set default • / filter • esc back")
+	switch {
+	case m.err != nil:
+		header = appErrorBoundaryView(&m, m.err.Error())
+	case m.deleting:
+		if selected, ok := m.list.SelectedItem().(item); ok {
+			footer = appErrorBoundaryView(&m, fmt.Sprintf("Delete %s? (y/n)", selected.persona.Name))
+		}
+	}
 
 	return s.Base.Render(header + "\n" + body + "\n\n" + footer)
 }
@@ -0,0 +1,261 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/cpcf/meh/internal/rag"
+	"github.com/cpcf/meh/pkg/meh"
+)
+
+const replHelp = `Commands:
+  /model [name]     Show the available models, or switch to one
+  /persona [name]   Show the personas, or switch to one and start over
+  /reset            Start a new conversation
+  /save [name]      Save the conversation, optionally naming it
+  /attach <path>    Attach a PNG or JPEG image to the next message
+  /stats            Show the token counts and speed of the session
+  /help             Show this help
+  /quit             Leave (or press Ctrl+D)
+Ctrl+C stops a reply that is being generated.`
+
+// repl is a line-oriented chat over stdin and stdout, for terminals that
+// cannot host the TUI and for scripted conversations.
+type repl struct {
+	conf    *meh.Config
+	opts    Options
+	persona meh.Persona
+	client  *meh.Client
+	session *Session
+	rl      *readline.Instance
+	out     io.Writer  // where replies are printed
+	index   *rag.Index // searched for passages to add to each message, if set
+	images  []string   // attached to the next message
+}
+
+// runREPL chats with the persona until the user quits or stdin is exhausted.
+// A non-nil session is resumed, and any query in opts is sent first. images
+// are attached to the first message. If index is set, passages found in it
+// are added to each message.
+func runREPL(conf *meh.Config, opts Options, persona meh.Persona, session *Session, images []string, index *rag.Index) error {
+	r := &repl{conf: conf, opts: opts, out: replyOutput(opts.Raw), index: index}
+	if err := r.setPersona(persona, session); err != nil {
+		return err
+	}
+	r.images = images
+
+	cfg := &readline.Config{
+		Prompt:          "> ",
+		InterruptPrompt: "^C",
+		EOFPrompt:       "/quit",
+		AutoComplete: readline.NewPrefixCompleter(
+			readline.PcItem("/model"),
+			readline.PcItem("/persona"),
+			readline.PcItem("/reset"),
+			readline.PcItem("/save"),
+			readline.PcItem("/attach"),
+			readline.PcItem("/stats"),
+			readline.PcItem("/help"),
+			readline.PcItem("/quit"),
+		),
+	}
+	if dir, err := meh.ConfigDir(); err == nil {
+		cfg.HistoryFile = filepath.Join(dir, "repl_history")
+	}
+	// Without a terminal, e.g. when lines are piped in, keep stdout to replies.
+	if !readline.DefaultIsTerminal() {
+		cfg.Prompt = ""
+	}
+	rl, err := readline.NewEx(cfg)
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+	r.rl = rl
+
+	if len(opts.QueryArgs) > 0 {
+		if err := r.send(strings.Join(opts.QueryArgs, " ")); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}
+
+	for {
+		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case line == "/quit" || line == "/exit":
+			return nil
+		case strings.HasPrefix(line, "/"):
+			err = r.command(line)
+		default:
+			err = r.send(line)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}
+}
+
+// setPersona switches to persona, resuming session or starting a new one.
+func (r *repl) setPersona(persona meh.Persona, session *Session) error {
+	persona = applyOverrides(persona, r.opts)
+	client, err := meh.NewClient(persona)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		session = NewSession(persona)
+	} else {
+		client.SelectModel(session.Model)
+		client.SetTree(session.Conversation())
+	}
+	r.persona, r.client, r.session = persona, client, session
+	return nil
+}
+
+// send chats with the model, printing the reply as it streams in. Ctrl+C
+// stops the reply without leaving the REPL.
+func (r *repl) send(message string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var sources []rag.Result
+	if r.index != nil {
+		var err error
+		if sources, err = searchIndex(ctx, r.client.API(), r.index, message, r.opts.chunks()); err != nil {
+			return err
+		}
+		message = retrievalPrompt(message, sources)
+	}
+
+	stream := r.client.Chat(ctx, message, r.images...)
+	r.images = nil
+	reply, stats, err := printReply(stream, r.out, r.approve)
+	if reply != "" {
+		fmt.Println()
+	}
+	if len(sources) > 0 {
+		fmt.Fprintf(os.Stderr, "[sources: %s]\n", sourceList(sources))
+	}
+	if stats != nil {
+		r.session.Usage.Add(*stats)
+		if r.opts.Stats {
+			printStats(*stats, r.session.Usage)
+		}
+	}
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "(interrupted)")
+	}
+
+	r.session.Record(r.client.Tree())
+	if saveErr := r.session.Save(); saveErr != nil && err == nil {
+		err = fmt.Errorf("error saving session: %w", saveErr)
+	}
+	return err
+}
+
+// approve asks the user whether the model may run a tool call. Without a
+// terminal there is no one to ask, and the answer would be taken from the
+// piped script, so the call is declined.
+func (r *repl) approve(call meh.ToolCall) bool {
+	if !readline.DefaultIsTerminal() {
+		return false
+	}
+	prompt := r.rl.Config.Prompt
+	r.rl.SetPrompt("Allow? (y/n) ")
+	defer r.rl.SetPrompt(prompt)
+	line, err := r.rl.Readline()
+	if err != nil {
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
+}
+
+// command runs a slash command.
+func (r *repl) command(line string) error {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "/help":
+		fmt.Println(replHelp)
+	case "/model":
+		if arg == "" {
+			for _, model := range r.client.Models() {
+				fmt.Println(model)
+			}
+			return nil
+		}
+		r.client.SelectModel(arg)
+		r.session.Model = arg
+		fmt.Printf("Using model %s\n", arg)
+	case "/persona":
+		if arg == "" {
+			for _, p := range r.conf.Personas {
+				fmt.Println(p.Name)
+			}
+			return nil
+		}
+		persona, ok := r.conf.FindPersona(arg)
+		if !ok {
+			return fmt.Errorf("no persona named %q", arg)
+		}
+		if err := r.setPersona(persona, nil); err != nil {
+			return err
+		}
+		fmt.Printf("Chatting with %s\n", persona.Name)
+	case "/reset":
+		if err := r.setPersona(r.persona, nil); err != nil {
+			return err
+		}
+		fmt.Println("Started a new conversation")
+	case "/save":
+		if arg != "" {
+			r.session.Name = arg
+		}
+		if !r.session.Resumed() {
+			return errors.New("nothing to save yet")
+		}
+		if err := r.session.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Saved session %s\n", r.session.Title())
+	case "/attach":
+		if arg == "" {
+			return errors.New("usage: /attach <path>")
+		}
+		img, err := meh.LoadImage(arg)
+		if err != nil {
+			return err
+		}
+		r.images = append(r.images, img)
+		fmt.Printf("Attached %s to the next message\n", filepath.Base(arg))
+	case "/stats":
+		if r.session.Usage.Replies == 0 {
+			return errors.New("no replies yet")
+		}
+		fmt.Println(r.session.Usage)
+	default:
+		return fmt.Errorf("unknown command %s, try /help", name)
+	}
+	return nil
+}
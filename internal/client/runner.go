@@ -1,24 +1,62 @@
 package client
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/cpcf/meh/internal/ollama"
+	"github.com/cpcf/meh/internal/rag"
+	"github.com/cpcf/meh/internal/schema"
+	"github.com/cpcf/meh/pkg/meh"
 )
 
 // Options represents the command-line options.
 type Options struct {
-	FilePath  string
+	// FilePaths are files, globs and directories whose contents are added to
+	// the query, within a budget of Budget tokens if it is set.
+	FilePaths []string
+	Budget    int
 	Config    bool
 	Persona   string
 	Help      bool
 	QueryArgs []string
+	// Command is a subcommand such as models and its arguments, see IsCommand.
+	Command []string
+	// Continue resumes the most recent session; Session resumes a named one.
+	Continue bool
+	Session  string
+	// Interactive chats on the command line instead of in the TUI.
+	Interactive bool
+	// Images are paths of PNG or JPEG files to attach to the first message.
+	Images []string
+	// Format ("json") and Schema (a JSON schema file) override the persona's
+	// response format.
+	Format string
+	Schema string
+	// ModelOptions override the persona's generation options.
+	ModelOptions meh.Options
+	// Raw prints replies as they are instead of rendering their markdown.
+	Raw bool
+	// Code prints only the code blocks of the reply to a one-shot query.
+	Code bool
+	// Stats prints the token counts and speed of each reply to stderr.
+	Stats bool
+	// Template names a prompt template to fill in with the query, and
+	// Variables holds values for its variables.
+	Template  string
+	Variables map[string]string
+	// Index names an index made with meh index to search for passages
+	// relevant to each message, Chunks of which are added to it.
+	Index  string
+	Chunks int
 }
 
 // RunApp is the main entry point into the application.
@@ -31,27 +69,99 @@ func RunApp(opts Options) error {
 		return EditConfig()
 	}
 
-	conf, err := LoadConfig()
-	if err != nil {
-		if _, ok := err.(ErrNoConfig); ok {
-			conf = &Config{}
-			SaveConfig(conf)
+	conf, err := meh.LoadConfig()
+	switch {
+	case errors.Is(err, meh.ErrNoConfig):
+		conf = &meh.Config{}
+		meh.SaveConfig(conf)
+	case err != nil:
+		return err
+	}
+
+	var session *Session
+	if opts.Continue || opts.Session != "" {
+		session, err = FindSession(opts.Session)
+		if err != nil {
+			return err
+		}
+		if opts.Persona == "" {
+			opts.Persona = session.Persona
 		}
 	}
 
-	persona, havePersona := conf.LoadDefaultPersona(opts)
+	var tmpl *meh.Template
+	if opts.Template != "" && len(opts.Command) == 0 {
+		t, err := findTemplate(conf, opts.Template)
+		if err != nil {
+			return err
+		}
+		if opts.Persona == "" {
+			opts.Persona = t.Persona
+		}
+		tmpl = &t
+	}
+
+	images, err := loadImages(opts.Images)
+	if err != nil {
+		return err
+	}
+
+	persona, havePersona := conf.SelectPersona(opts.Persona)
+	if len(opts.Command) > 0 {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		return runCommand(ctx, conf, persona, opts.Command)
+	}
+	if err := buildInput(&opts, persona, tmpl); err != nil {
+		return err
+	}
+	var index *rag.Index
+	if opts.Index != "" {
+		if index, err = loadIndex(opts.Index); err != nil {
+			return err
+		}
+	}
+	if opts.Interactive {
+		if !havePersona {
+			return errors.New("no persona selected, create one in the TUI or select one with -p")
+		}
+		return runREPL(conf, opts, persona, session, images, index)
+	}
 	if havePersona {
-		api := ollama.NewAPI(persona.APIURL, persona.Model, persona.SystemPrompt)
-		switch {
-		case opts.FilePath != "":
-			return runFile(api, opts.FilePath)
-		case len(opts.QueryArgs) > 0:
-			query := strings.Join(opts.QueryArgs, " ")
-			return runQuery(api, query)
+		persona = applyOverrides(persona, opts)
+		client, err := meh.NewClient(persona)
+		if err != nil {
+			return err
+		}
+		format, _ := persona.ResponseFormat()
+		q := cliQuery{images: images, format: format, out: replyOutput(opts.Raw), code: opts.Code, stats: opts.Stats, index: index, chunks: opts.chunks()}
+		if q.code {
+			q.out = io.Discard
+		}
+		cliSession := session
+		if cliSession == nil {
+			cliSession = NewSession(persona)
+		} else {
+			client.SelectModel(cliSession.Model)
+			client.SetTree(cliSession.Conversation())
+		}
+		// Ctrl+C cancels an in-flight generation instead of killing the process.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if len(opts.QueryArgs) > 0 {
+			q.text = strings.Join(opts.QueryArgs, " ")
+			return runQuery(ctx, client, q, cliSession)
 		}
 	}
 
-	p := tea.NewProgram(NewMainModel(conf, persona), tea.WithAltScreen())
+	m := NewMainModel(conf, persona, opts.Raw)
+	if index != nil {
+		m = m.WithIndex(index, opts.chunks())
+	}
+	if session != nil {
+		m = m.ResumeSession(session)
+	}
+	p := tea.NewProgram(m, tea.WithAltScreen())
 
 	if _, err := p.Run(); err != nil {
 		log.Fatal(err)
@@ -61,40 +171,234 @@ func RunApp(opts Options) error {
 
 }
 
-// runFile reads input from a file and sends it as a prompt.
-func runFile(api API, filePath string) error {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return fmt.Errorf("error opening file: %w", err)
+// chunks returns how many passages of the index to add to each message.
+func (o Options) chunks() int {
+	if o.Chunks > 0 {
+		return o.Chunks
+	}
+	return defaultChunks
+}
+
+// applyOverrides returns the persona with the command-line settings in opts
+// layered over its own.
+func applyOverrides(persona meh.Persona, opts Options) meh.Persona {
+	persona.Options = persona.Options.Merge(opts.ModelOptions)
+	if opts.Format != "" {
+		persona.Format, persona.Schema = opts.Format, ""
+	}
+	if opts.Schema != "" {
+		persona.Schema = opts.Schema
 	}
-	defer file.Close()
+	return persona
+}
 
-	content, err := io.ReadAll(file)
-	if err != nil {
-		return fmt.Errorf("error reading file: %w", err)
+// cliQuery is a one-shot query from the command line.
+type cliQuery struct {
+	text   string
+	images []string
+	format json.RawMessage // the reply must conform to this, if set
+	out    io.Writer       // where the reply is printed
+	code   bool            // print only the reply's code blocks once it's complete
+	stats  bool            // print the reply's stats to stderr
+	index  *rag.Index      // searched for passages to answer from, if set
+	chunks int             // how many passages of index to add
+}
+
+// buildInput adds the files given with -f to the query in opts and, if t is
+// set, fills in the template with the result, leaving it as the query.
+func buildInput(opts *Options, persona meh.Persona, t *meh.Template) error {
+	query := strings.Join(opts.QueryArgs, " ")
+	if len(opts.FilePaths) > 0 {
+		files, err := readInputFiles(opts.FilePaths, inputBudget(*opts, persona))
+		if err != nil {
+			return err
+		}
+		if query != "" {
+			query += "\n\n"
+		}
+		query += files
+	}
+	if t != nil {
+		var err error
+		if query, err = fillTemplate(*t, query, opts.Variables); err != nil {
+			return err
+		}
+	}
+	opts.QueryArgs = nil
+	if query != "" {
+		opts.QueryArgs = []string{query}
+	}
+	return nil
+}
+
+// runQuery sends a command-line query to the model and records the exchange in
+// session. A resumed session continues the conversation through Chat, while a
+// new one sends a single prompt.
+// It returns once the response is complete or ctx is cancelled, and reports
+// any error from the API, or a reply that doesn't match the requested format,
+// so the caller can exit non-zero.
+func runQuery(ctx context.Context, client *meh.Client, q cliQuery, session *Session) error {
+	var sources []rag.Result
+	if q.index != nil {
+		var err error
+		if sources, err = searchIndex(ctx, client.API(), q.index, q.text, q.chunks); err != nil {
+			return err
+		}
+		q.text = retrievalPrompt(q.text, sources)
+	}
+	var stream *meh.Stream
+	resumed := session.Resumed()
+	if resumed {
+		stream = client.Chat(ctx, q.text, q.images...)
+	} else {
+		stream = client.Generate(ctx, q.text, q.images...)
+	}
+	reply, stats, err := printReply(stream, q.out, nil)
+	if ctx.Err() != nil {
+		// The reply was cut short by Ctrl+C, so it isn't saved to the session.
+		if reply != "" && !q.code {
+			fmt.Println()
+		}
+		return ctx.Err()
+	}
+	if reply == "" {
+		// Nothing is saved, but an empty reply still fails --code and a
+		// required format.
+		if err == nil && q.code {
+			err = printCode(reply)
+		}
+		if err == nil {
+			err = checkFormat(q.format, reply)
+		}
+		return err
+	}
+	if q.code {
+		if codeErr := printCode(reply); codeErr != nil && err == nil {
+			err = codeErr
+		}
+	} else {
+		fmt.Println()
+	}
+	if len(sources) > 0 {
+		fmt.Fprintf(os.Stderr, "[sources: %s]\n", sourceList(sources))
+	}
+	if stats != nil {
+		session.Usage.Add(*stats)
+		if q.stats {
+			printStats(*stats, session.Usage)
+		}
+	}
+
+	tree := client.Tree()
+	if !resumed {
+		tree.Append(meh.Message{Role: "user", Content: q.text, Images: q.images})
+		tree.Append(meh.Message{Role: "assistant", Content: reply})
+	}
+	session.Record(tree)
+	if saveErr := session.Save(); saveErr != nil && err == nil {
+		err = fmt.Errorf("error saving session: %w", saveErr)
+	}
+	if err == nil {
+		err = checkFormat(q.format, reply)
 	}
-	query := string(content)
-	results := make(chan string)
-	go api.Prompt(query, results, true)
-	for res := range results {
-		fmt.Print(res)
+	return err
+}
+
+// printCode prints the code blocks in reply, separated by blank lines, or
+// returns an error if it has none.
+func printCode(reply string) error {
+	blocks := codeBlocks(reply)
+	if len(blocks) == 0 {
+		return errors.New("response has no code blocks")
+	}
+	for i, block := range blocks {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(block.code)
 	}
-	fmt.Println()
 	return nil
 }
 
-// runQuery sends a command-line query to the API.
-func runQuery(api API, query string) error {
-	results := make(chan string)
-	go api.Prompt(query, results, true)
-	for res := range results {
-		fmt.Print(res)
+// checkFormat returns an error if reply is not JSON, or doesn't match the
+// schema, as required by format.
+func checkFormat(format json.RawMessage, reply string) error {
+	switch {
+	case len(format) == 0:
+		return nil
+	case string(format) == `"json"`:
+		if !json.Valid([]byte(reply)) {
+			return errors.New("response is not valid JSON")
+		}
+		return nil
+	}
+	if err := schema.Validate(format, []byte(reply)); err != nil {
+		return fmt.Errorf("response does not match schema: %w", err)
 	}
-	fmt.Println()
 	return nil
 }
 
+// loadImages reads the image files at paths, base64 encoded for attaching to
+// a message.
+func loadImages(paths []string) ([]string, error) {
+	images := make([]string, 0, len(paths))
+	for _, path := range paths {
+		img, err := meh.LoadImage(path)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// printReply prints generated text to out as it streams in, and tool calls to
+// stderr. Calls needing approval are put to approve, or declined if it is nil.
+// It returns the full reply, its stats if it was completed, and the error
+// reported by the API, if any.
+func printReply(stream *meh.Stream, out io.Writer, approve func(meh.ToolCall) bool) (string, *meh.Stats, error) {
+	for ev := range stream.Events() {
+		switch ev.Kind {
+		case meh.TokenEvent:
+			io.WriteString(out, ev.Content)
+		case meh.ToolCallEvent:
+			// Show the text leading up to the call before the call itself.
+			flushReply(out)
+			fmt.Fprintf(os.Stderr, "[%s]\n", ev.Call)
+			if ev.Approve != nil {
+				allowed := approve != nil && approve(ev.Call)
+				if !allowed {
+					fmt.Fprintln(os.Stderr, "[declined]")
+				}
+				ev.Approve <- allowed
+			}
+		}
+	}
+	flushReply(out)
+	reply, err := stream.Text()
+	if stats, ok := stream.Stats(); ok {
+		return reply, &stats, err
+	}
+	return reply, nil, err
+}
+
+// printStats prints the stats of a reply to stderr, followed by the totals of
+// the session once it has more than one reply.
+func printStats(stats meh.Stats, usage Usage) {
+	fmt.Fprintf(os.Stderr, "[%s]\n", formatStats(stats))
+	if usage.Replies > 1 {
+		fmt.Fprintf(os.Stderr, "[session: %s]\n", usage)
+	}
+}
+
 func usage() {
 	fmt.Println("Usage: [options] <query>")
+	fmt.Println("       [options] models <command>")
+	fmt.Println("       [options] index [-name name] [-model model] <dir>")
+	fmt.Println("       [options] embed [-model model] < lines")
+	fmt.Println("       [options] similar [-model model] [-n count] <query> < lines")
+	fmt.Println("       [options] serve [-addr address]")
+	fmt.Println("       persona <command>")
+	fmt.Println("       [options] -- <query>    (for queries starting with a subcommand's name)")
 	flag.PrintDefaults()
 }
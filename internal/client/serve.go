@@ -0,0 +1,499 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cpcf/meh/internal/openai"
+	"github.com/cpcf/meh/pkg/meh"
+)
+
+const serveUsage = `Usage: meh [-p persona] serve [-addr address]
+
+Serve the personas over the OpenAI API, at /v1/chat/completions,
+/v1/completions and /v1/models, for tools that only speak that API. The model
+of a request names the persona to answer it, whose system prompt and options
+are used; requests without a model go to the selected or default persona.
+The personas' tools are not offered to the model.
+
+Flags:
+  -addr address    Address to listen on (default: ` + defaultServeAddr + `)`
+
+// defaultServeAddr only accepts connections from this machine, as the
+// server has no authentication.
+const defaultServeAddr = "localhost:8080"
+
+// runServe implements meh serve.
+func runServe(ctx context.Context, conf *meh.Config, persona meh.Persona, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	addr := fs.String("addr", defaultServeAddr, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return UsageError(serveUsage)
+	}
+	if len(conf.Personas) == 0 {
+		return errors.New("no personas to serve, create one in the TUI or with meh persona add")
+	}
+
+	s := &server{conf: conf, persona: persona}
+	srv := &http.Server{Addr: *addr, Handler: s.routes()}
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("serving %d personas at http://%s/v1", len(conf.Personas), ln.Addr())
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdown)
+	}
+}
+
+// server answers OpenAI API requests with the personas in conf.
+type server struct {
+	conf    *meh.Config
+	persona meh.Persona // answers requests that don't name a model
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/models", s.handleModels)
+	mux.HandleFunc("GET /v1/models/{id}", s.handleModel)
+	mux.HandleFunc("POST /v1/chat/completions", s.handleChat)
+	mux.HandleFunc("POST /v1/completions", s.handleCompletion)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("no route for %s %s", r.Method, r.URL.Path))
+	})
+	return mux
+}
+
+// modelObject describes a persona as a model.
+type modelObject struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+func personaModel(p meh.Persona) modelObject {
+	return modelObject{ID: p.Name, Object: "model", OwnedBy: "meh"}
+}
+
+func (s *server) handleModels(w http.ResponseWriter, r *http.Request) {
+	models := make([]modelObject, len(s.conf.Personas))
+	for i, p := range s.conf.Personas {
+		models[i] = personaModel(p)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"object": "list", "data": models})
+}
+
+func (s *server) handleModel(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.conf.FindPersona(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("no persona named %q", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, http.StatusOK, personaModel(p))
+}
+
+// sampling holds the generation parameters common to both kinds of
+// completion request.
+type sampling struct {
+	Temperature   *float64              `json:"temperature,omitempty"`
+	TopP          *float64              `json:"top_p,omitempty"`
+	TopK          *int                  `json:"top_k,omitempty"`
+	MaxTokens     *int                  `json:"max_tokens,omitempty"`
+	Seed          *int                  `json:"seed,omitempty"`
+	Stop          json.RawMessage       `json:"stop,omitempty"` // a string or a list of them
+	Stream        bool                  `json:"stream"`
+	StreamOptions *openai.StreamOptions `json:"stream_options,omitempty"`
+}
+
+// options maps the parameters to their Ollama equivalents.
+func (p sampling) options() (meh.Options, error) {
+	opts := meh.Options{}
+	if p.Temperature != nil {
+		opts["temperature"] = *p.Temperature
+	}
+	if p.TopP != nil {
+		opts["top_p"] = *p.TopP
+	}
+	if p.TopK != nil {
+		opts["top_k"] = *p.TopK
+	}
+	if p.MaxTokens != nil {
+		opts["num_predict"] = *p.MaxTokens
+	}
+	if p.Seed != nil {
+		opts["seed"] = *p.Seed
+	}
+	if len(p.Stop) > 0 && string(p.Stop) != "null" {
+		stop, err := stringOrList(p.Stop)
+		if err != nil {
+			return nil, fmt.Errorf("stop: %w", err)
+		}
+		opts["stop"] = stop
+	}
+	return opts, nil
+}
+
+// stringOrList decodes a JSON string, or a list of strings.
+func stringOrList(data json.RawMessage) ([]string, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return []string{s}, nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, errors.New("expected a string or a list of strings")
+	}
+	return list, nil
+}
+
+type chatRequest struct {
+	Model          string                 `json:"model"`
+	Messages       []openai.Message       `json:"messages"`
+	ResponseFormat *openai.ResponseFormat `json:"response_format,omitempty"`
+	sampling
+}
+
+type completionRequest struct {
+	Model  string          `json:"model"`
+	Prompt json.RawMessage `json:"prompt"` // a string, or a list holding one
+	sampling
+}
+
+func (s *server) handleChat(w http.ResponseWriter, r *http.Request) {
+	var req chatRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if len(req.Messages) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "messages must not be empty")
+		return
+	}
+	messages := make([]meh.Message, len(req.Messages))
+	for i, m := range req.Messages {
+		msg, err := fromOpenAI(m)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("messages[%d]: %v", i, err))
+			return
+		}
+		messages[i] = msg
+	}
+	last := messages[len(messages)-1]
+	if last.Role != "user" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "the last message must be from the user")
+		return
+	}
+
+	client, persona, ok := s.client(w, req.Model, req.sampling, req.ResponseFormat)
+	if !ok {
+		return
+	}
+	// The persona's system prompt comes before the conversation, which may
+	// hold system messages of its own.
+	tree := meh.NewTree(nil)
+	if persona.SystemPrompt != "" {
+		tree.Append(meh.Message{Role: "system", Content: persona.SystemPrompt})
+	}
+	for _, m := range messages[:len(messages)-1] {
+		tree.Append(m)
+	}
+	client.SetTree(tree)
+
+	respond(w, client.Chat(r.Context(), last.Content, last.Images...), completionFormat{
+		object:       "chat.completion",
+		id:           "chatcmpl-" + randomID(),
+		model:        persona.Name,
+		stream:       req.Stream,
+		includeUsage: req.StreamOptions != nil && req.StreamOptions.IncludeUsage,
+		choice: func(text string, done bool) interface{} {
+			if !done {
+				return map[string]interface{}{"index": 0, "delta": map[string]string{"role": "assistant", "content": text}, "finish_reason": nil}
+			}
+			if req.Stream {
+				return map[string]interface{}{"index": 0, "delta": map[string]string{}, "finish_reason": "stop"}
+			}
+			return map[string]interface{}{"index": 0, "message": map[string]string{"role": "assistant", "content": text}, "finish_reason": "stop"}
+		},
+	})
+}
+
+func (s *server) handleCompletion(w http.ResponseWriter, r *http.Request) {
+	var req completionRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	prompts, err := stringOrList(req.Prompt)
+	if err != nil || len(prompts) != 1 {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "prompt must be a string, only one prompt per request is supported")
+		return
+	}
+
+	client, persona, ok := s.client(w, req.Model, req.sampling, nil)
+	if !ok {
+		return
+	}
+	respond(w, client.Generate(r.Context(), prompts[0]), completionFormat{
+		object:       "text_completion",
+		id:           "cmpl-" + randomID(),
+		model:        persona.Name,
+		stream:       req.Stream,
+		includeUsage: req.StreamOptions != nil && req.StreamOptions.IncludeUsage,
+		choice: func(text string, done bool) interface{} {
+			var finish interface{}
+			if done {
+				finish = "stop"
+			}
+			return map[string]interface{}{"index": 0, "text": text, "finish_reason": finish}
+		},
+	})
+}
+
+// decodeRequest decodes the JSON body of r into v. Bodies that aren't sent
+// as application/json are refused, which also stops web pages from posting
+// to the server without a CORS preflight. If decoding fails it writes the
+// error and reports false.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "invalid_request_error", "Content-Type must be application/json")
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("invalid request: %v", err))
+		return false
+	}
+	return true
+}
+
+// client returns a client for the persona named by model, with the request's
+// parameters layered over the persona's options. If there is no such persona
+// it writes the error and reports false.
+func (s *server) client(w http.ResponseWriter, model string, params sampling, format *openai.ResponseFormat) (*meh.Client, meh.Persona, bool) {
+	persona := s.persona
+	if model != "" {
+		var ok bool
+		if persona, ok = s.conf.FindPersona(model); !ok {
+			writeError(w, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("no persona named %q", model))
+			return nil, persona, false
+		}
+	}
+	if persona.IsZero() {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "model must name a persona, as there is no default persona")
+		return nil, persona, false
+	}
+	opts, err := params.options()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return nil, persona, false
+	}
+	persona.Options = persona.Options.Merge(opts)
+	// Tools would let anyone who can reach the server read files and run
+	// commands as the user, so they are never offered to the model here.
+	persona.Tools, persona.Commands = nil, nil
+	var schema json.RawMessage
+	if format != nil {
+		switch {
+		case format.Type == "json_object":
+			persona.Format, persona.Schema = "json", ""
+		case format.Type == "json_schema" && format.JSONSchema != nil:
+			schema = format.JSONSchema.Schema
+		}
+	}
+	client, err := meh.NewClient(persona)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", fmt.Sprintf("persona %s: %v", persona.Name, err))
+		return nil, persona, false
+	}
+	if schema != nil {
+		client.API().SetFormat(schema)
+	}
+	return client, persona, true
+}
+
+// fromOpenAI converts a message from a request, whose content is a string or
+// a list of text and image parts. Images must be base64 data URLs.
+func fromOpenAI(m openai.Message) (meh.Message, error) {
+	msg := meh.Message{Role: m.Role}
+	switch m.Role {
+	case "system", "user", "assistant":
+	case "developer":
+		msg.Role = "system"
+	default:
+		return msg, fmt.Errorf("unsupported role %q", m.Role)
+	}
+	switch content := m.Content.(type) {
+	case nil:
+	case string:
+		msg.Content = content
+	case []interface{}:
+		var texts []string
+		for _, part := range content {
+			p, _ := part.(map[string]interface{})
+			switch p["type"] {
+			case "text":
+				text, _ := p["text"].(string)
+				texts = append(texts, text)
+			case "image_url":
+				image, _ := p["image_url"].(map[string]interface{})
+				url, _ := image["url"].(string)
+				_, data, ok := strings.Cut(url, ";base64,")
+				if !strings.HasPrefix(url, "data:") || !ok {
+					return msg, errors.New("images must be given as base64 data URLs")
+				}
+				msg.Images = append(msg.Images, data)
+			default:
+				return msg, fmt.Errorf("unsupported content part %v", p["type"])
+			}
+		}
+		msg.Content = strings.Join(texts, "\n")
+	default:
+		return msg, errors.New("content must be a string or a list of parts")
+	}
+	return msg, nil
+}
+
+// completionFormat shapes the responses to a completion request.
+type completionFormat struct {
+	object       string // of the complete response; chunks add .chunk to chat completions
+	id           string
+	model        string
+	stream       bool
+	includeUsage bool // send the token counts in a final chunk when streaming
+	// choice returns the choice holding text, a chunk of the reply or, when
+	// done is set, the whole of it.
+	choice func(text string, done bool) interface{}
+}
+
+type completionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (f completionFormat) response(object string, choices []interface{}, u *completionUsage) map[string]interface{} {
+	resp := map[string]interface{}{
+		"id":      f.id,
+		"object":  object,
+		"created": time.Now().Unix(),
+		"model":   f.model,
+		"choices": choices,
+	}
+	if u != nil {
+		resp["usage"] = u
+	}
+	return resp
+}
+
+// respond writes the reply as it streams in as server-sent events or, if the
+// request didn't ask for a stream, as a single response. Tool calls that need
+// approval are declined, as there is no one to ask.
+func respond(w http.ResponseWriter, stream *meh.Stream, f completionFormat) {
+	chunkObject := f.object
+	if f.object == "chat.completion" {
+		chunkObject += ".chunk"
+	}
+	started := false
+	flusher, _ := w.(http.Flusher)
+	event := func(v interface{}) {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	for ev := range stream.Events() {
+		switch ev.Kind {
+		case meh.TokenEvent:
+			if f.stream {
+				event(f.response(chunkObject, []interface{}{f.choice(ev.Content, false)}, nil))
+			}
+		case meh.ToolCallEvent:
+			if ev.Approve != nil {
+				ev.Approve <- false
+			}
+		}
+	}
+	reply, err := stream.Text()
+	if err != nil {
+		if started {
+			event(map[string]interface{}{"error": apiError{Message: err.Error(), Type: "server_error"}})
+			return
+		}
+		writeError(w, http.StatusBadGateway, "server_error", err.Error())
+		return
+	}
+	var u *completionUsage
+	if stats, ok := stream.Stats(); ok {
+		u = &completionUsage{
+			PromptTokens:     stats.PromptEvalCount,
+			CompletionTokens: stats.EvalCount,
+			TotalTokens:      stats.PromptEvalCount + stats.EvalCount,
+		}
+	}
+
+	if !f.stream {
+		writeJSON(w, http.StatusOK, f.response(f.object, []interface{}{f.choice(reply, true)}, u))
+		return
+	}
+	event(f.response(chunkObject, []interface{}{f.choice("", true)}, nil))
+	if f.includeUsage && u != nil {
+		event(f.response(chunkObject, []interface{}{}, u))
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// apiError is an error as the OpenAI API reports it.
+type apiError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+func writeError(w http.ResponseWriter, status int, kind, message string) {
+	writeJSON(w, status, map[string]apiError{"error": {Message: message, Type: kind}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// randomID returns a random hex string to identify a completion.
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
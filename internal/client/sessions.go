@@ -0,0 +1,380 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/cpcf/meh/pkg/meh"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrNoSession is returned when a requested session cannot be found.
+var ErrNoSession = errors.New("no such session")
+
+// Session is a saved conversation that can be resumed later.
+type Session struct {
+	ID       string        `yaml:"id"`
+	Name     string        `yaml:"name,omitempty"`
+	Persona  string        `yaml:"persona"`
+	Model    string        `yaml:"model"`
+	Created  time.Time     `yaml:"created"`
+	Updated  time.Time     `yaml:"updated"`
+	Messages []meh.Message `yaml:"messages"`
+	// Tree holds every branch of the conversation, of which Messages is the
+	// current one. It is only saved once the conversation has branched.
+	Tree *meh.Tree `yaml:"tree,omitempty"`
+	// Usage totals the tokens of the replies in the session.
+	Usage Usage `yaml:"usage,omitempty"`
+}
+
+// NewSession starts an empty session for the persona.
+func NewSession(p meh.Persona) *Session {
+	now := time.Now()
+	suffix := make([]byte, 2)
+	rand.Read(suffix)
+	return &Session{
+		ID:      now.Format("20060102-150405") + "-" + hex.EncodeToString(suffix),
+		Persona: p.Name,
+		Model:   p.Model,
+		Created: now,
+		Updated: now,
+	}
+}
+
+// Title is the session's name, or the start of its first message if unnamed.
+func (s *Session) Title() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	for _, m := range s.Messages {
+		if m.Role == "user" {
+			title := []rune(strings.Join(strings.Fields(m.Content), " "))
+			if len(title) > 40 {
+				return string(title[:40]) + "…"
+			}
+			return string(title)
+		}
+	}
+	return s.ID
+}
+
+// Record replaces the session's conversation with the one in tree.
+func (s *Session) Record(tree meh.Tree) {
+	s.Messages = tree.Branch()
+	s.Tree = nil
+	if len(tree.Nodes) > len(s.Messages) {
+		s.Tree = &tree
+	}
+	s.Updated = time.Now()
+}
+
+// Conversation returns the session's conversation with all its branches.
+func (s *Session) Conversation() meh.Tree {
+	if s.Tree != nil {
+		return s.Tree.Clone()
+	}
+	return meh.NewTree(s.Messages)
+}
+
+// Resumed reports whether the session already holds a conversation.
+func (s *Session) Resumed() bool {
+	for _, m := range s.Messages {
+		if m.Role != "system" {
+			return true
+		}
+	}
+	return false
+}
+
+func sessionsDir() (string, error) {
+	dir, err := meh.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sessions"), nil
+}
+
+func (s *Session) path() (string, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, s.ID+".yml"), nil
+}
+
+// Save writes the session to the sessions directory. Sessions without any
+// messages from the user are not worth keeping and are skipped.
+func (s *Session) Save() error {
+	if !s.Resumed() {
+		return nil
+	}
+	path, err := s.path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Delete removes the session's file.
+func (s *Session) Delete() error {
+	path, err := s.path()
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// LoadSessions reads all saved sessions, most recently updated first. A
+// session file that can't be read is skipped: the others are returned along
+// with an error naming each file skipped.
+func LoadSessions() ([]*Session, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yml"))
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*Session, 0, len(paths))
+	var errs []error
+	for _, path := range paths {
+		s, err := loadSession(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("skipped session %s: %w", filepath.Base(path), err))
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Updated.After(sessions[j].Updated)
+	})
+	return sessions, errors.Join(errs...)
+}
+
+func loadSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// FindSession returns the session with the given name or ID. An empty name
+// finds the most recently updated session. Session files that can't be read
+// are reported on stderr and skipped.
+func FindSession(name string) (*Session, error) {
+	sessions, err := LoadSessions()
+	if err != nil {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(os.Stderr, "[%s]\n", line)
+		}
+	}
+	for _, s := range sessions {
+		if name == "" || s.Name == name || s.ID == name {
+			return s, nil
+		}
+	}
+	if name == "" {
+		return nil, ErrNoSession
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoSession, name)
+}
+
+type sessionItem struct {
+	session *Session
+}
+
+func (i sessionItem) Title() string { return i.session.Title() }
+func (i sessionItem) Description() string {
+	desc := fmt.Sprintf("%s - %s - %s", i.session.Persona, i.session.Model, i.session.Updated.Format("2006-01-02 15:04"))
+	if u := i.session.Usage; u.Replies > 0 {
+		desc += fmt.Sprintf(" - %d tokens", u.PromptTokens+u.Tokens)
+	}
+	return desc
+}
+func (i sessionItem) FilterValue() string { return i.session.Title() }
+
+type sessionMsg *Session
+
+// OpenSessionCmd asks the main model to resume a session in the chat screen.
+func OpenSessionCmd(s *Session) tea.Cmd {
+	return func() tea.Msg {
+		return sessionMsg(s)
+	}
+}
+
+// SessionListModel lists saved sessions and lets the user reopen, rename and
+// delete them.
+type SessionListModel struct {
+	list     list.Model
+	input    textinput.Model
+	renaming bool
+	deleting bool
+	width    int
+	height   int
+	styles   *Styles
+	lg       *lipgloss.Renderer
+	err      error
+}
+
+func NewSessionListModel() SessionListModel {
+	sessions, err := LoadSessions()
+	items := make([]list.Item, len(sessions))
+	for i, s := range sessions {
+		items[i] = sessionItem{session: s}
+	}
+	lg := lipgloss.DefaultRenderer()
+	s := NewStyles(lg)
+
+	l := list.New(items, list.NewDefaultDelegate(), 0, 0)
+	l.SetShowHelp(false)
+	l.Title = "Sessions"
+
+	ti := textinput.New()
+	ti.Prompt = "Name: "
+	return SessionListModel{list: l, input: ti, lg: lg, styles: s, err: err}
+}
+
+func (m SessionListModel) Init() tea.Cmd {
+	return tea.WindowSize()
+}
+
+func (m SessionListModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		UpdateWidth(&m, msg.Width)
+		h, v := m.styles.Base.GetFrameSize()
+		m.height = msg.Height - v
+		m.list.SetSize(min(msg.Width-h, maxWidth), msg.Height-v-listVerticalOffset)
+	case tea.KeyMsg:
+		switch {
+		case m.renaming:
+			return m.updateRename(msg)
+		case m.deleting:
+			return m.updateDelete(msg)
+		case m.list.FilterState() == list.Filtering:
+			break
+		default:
+			selected, ok := m.list.SelectedItem().(sessionItem)
+			switch msg.String() {
+			case "esc", "ctrl+c", "q":
+				return m, BackToMain
+			case "enter":
+				if ok {
+					return m, OpenSessionCmd(selected.session)
+				}
+				return m, nil
+			case "r":
+				if ok {
+					m.renaming = true
+					m.input.SetValue(selected.session.Name)
+					return m, m.input.Focus()
+				}
+				return m, nil
+			case "d":
+				if ok {
+					m.deleting = true
+				}
+				return m, nil
+			}
+		}
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m SessionListModel) updateRename(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.renaming = false
+		m.input.Blur()
+		return m, nil
+	case "enter":
+		m.renaming = false
+		m.input.Blur()
+		if selected, ok := m.list.SelectedItem().(sessionItem); ok {
+			selected.session.Name = strings.TrimSpace(m.input.Value())
+			m.err = selected.session.Save()
+		}
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m SessionListModel) updateDelete(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.deleting = false
+	if msg.String() != "y" {
+		return m, nil
+	}
+	if selected, ok := m.list.SelectedItem().(sessionItem); ok {
+		if m.err = selected.session.Delete(); m.err == nil {
+			m.list.RemoveItem(m.list.Index())
+		}
+	}
+	return m, nil
+}
+
+func (m SessionListModel) View() string {
+	s := m.styles
+	body := s.Base.Render(m.list.View())
+
+	header := appBoundaryView(&m, "resume a session")
+	footer := appBoundaryView(&m, "enter open • r rename • d delete • / filter • esc back")
+	switch {
+	case m.err != nil:
+		header = appErrorBoundaryView(&m, m.err.Error())
+	case m.renaming:
+		footer = appBoundaryView(&m, m.input.View())
+	case m.deleting:
+		if selected, ok := m.list.SelectedItem().(sessionItem); ok {
+			footer = appErrorBoundaryView(&m, fmt.Sprintf("Delete %q? (y/n)", selected.session.Title()))
+		}
+	}
+
+	return s.Base.Render(header + "\n" + body + "\n\n" + footer)
+}
+
+func (m SessionListModel) Height() int {
+	return m.height
+}
+func (m SessionListModel) Width() int {
+	return m.width
+}
+
+func (m *SessionListModel) SetHeight(height int) {
+	m.height = height
+}
+func (m *SessionListModel) SetWidth(width int) {
+	m.width = width
+}
+
+func (m SessionListModel) Styles() *Styles {
+	return m.styles
+}
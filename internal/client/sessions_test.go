@@ -0,0 +1,47 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cpcf/meh/pkg/meh"
+)
+
+func TestLoadSessionsSkipsBadFiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	for i, content := range []string{"first", "second"} {
+		s := NewSession(meh.Persona{Name: "p", Model: "llama3"})
+		s.ID = content
+		s.Record(meh.NewTree([]meh.Message{{Role: "user", Content: content}}))
+		s.Updated = time.Date(2025, 1, 1+i, 0, 0, 0, 0, time.UTC)
+		if err := s.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir, err := sessionsDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.yml"), []byte("id: [unterminated"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := LoadSessions()
+	if err == nil || !strings.Contains(err.Error(), "broken.yml") {
+		t.Errorf("LoadSessions() error = %v, want one naming broken.yml", err)
+	}
+	var ids []string
+	for _, s := range sessions {
+		ids = append(ids, s.ID)
+	}
+	if strings.Join(ids, ",") != "second,first" {
+		t.Errorf("LoadSessions() = %q, want the good sessions, newest first", ids)
+	}
+
+	if s, err := FindSession("first"); err != nil || s.ID != "first" {
+		t.Errorf("FindSession() = %v, %v, want the session despite the broken file", s, err)
+	}
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cpcf/meh/pkg/meh"
+)
+
+// Usage totals the token counts and generation time of a session's replies.
+type Usage struct {
+	Replies      int           `yaml:"replies"`
+	PromptTokens int           `yaml:"prompt_tokens"`
+	Tokens       int           `yaml:"tokens"`     // generated
+	Generating   time.Duration `yaml:"generating"` // spent generating the tokens
+}
+
+// Add counts a reply with stats s.
+func (u *Usage) Add(s meh.Stats) {
+	u.Replies++
+	u.PromptTokens += s.PromptEvalCount
+	u.Tokens += s.EvalCount
+	u.Generating += s.EvalDuration
+}
+
+// String summarizes the usage, e.g. "3 replies • 120 prompt tokens • 480
+// tokens generated at 21.5 tokens/s".
+func (u Usage) String() string {
+	replies := "replies"
+	if u.Replies == 1 {
+		replies = "reply"
+	}
+	s := fmt.Sprintf("%d %s • %d prompt tokens • %d tokens generated", u.Replies, replies, u.PromptTokens, u.Tokens)
+	if u.Generating > 0 {
+		s += fmt.Sprintf(" at %.1f tokens/s", float64(u.Tokens)/u.Generating.Seconds())
+	}
+	return s
+}
+
+// formatStats describes the stats of a single reply, leaving out what the
+// API didn't report.
+func formatStats(s meh.Stats) string {
+	var parts []string
+	if rate := s.TokensPerSecond(); rate > 0 {
+		parts = append(parts, fmt.Sprintf("%d tokens at %.1f tokens/s", s.EvalCount, rate))
+	} else if s.EvalCount > 0 {
+		parts = append(parts, fmt.Sprintf("%d tokens", s.EvalCount))
+	}
+	if s.PromptEvalCount > 0 {
+		parts = append(parts, fmt.Sprintf("%d prompt tokens", s.PromptEvalCount))
+	}
+	if s.LoadDuration > 0 {
+		parts = append(parts, "load "+roundDuration(s.LoadDuration).String())
+	}
+	if s.TotalDuration > 0 {
+		parts = append(parts, "total "+roundDuration(s.TotalDuration).String())
+	}
+	return strings.Join(parts, " • ")
+}
+
+// roundDuration rounds d to a precision that reads well next to token counts.
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(10 * time.Millisecond)
+}
@@ -0,0 +1,210 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/cpcf/meh/pkg/meh"
+)
+
+type templateItem struct {
+	template meh.Template
+}
+
+func (i templateItem) Title() string { return i.template.Name }
+func (i templateItem) Description() string {
+	if i.template.Description != "" {
+		return i.template.Description
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(i.template.Body), "\n")
+	return line
+}
+func (i templateItem) FilterValue() string { return i.template.Name }
+
+// openTemplatesMsg asks the main model to show the templates from the chat.
+type openTemplatesMsg struct{}
+
+// templateMsg asks the main model to send a filled in template in the chat,
+// with persona if no chat is open.
+type templateMsg struct {
+	text    string
+	persona string
+}
+
+// TemplateListModel lists the prompt templates and fills in the selected one,
+// asking for its input and variables.
+type TemplateListModel struct {
+	list     list.Model
+	form     *huh.Form // asks for the selected template's input and variables
+	selected meh.Template
+	back     state // the screen to return to
+	width    int
+	height   int
+	styles   *Styles
+	lg       *lipgloss.Renderer
+	err      error
+}
+
+// NewTemplateListModel lists the templates in the config, returning to back
+// when done.
+func NewTemplateListModel(c *meh.Config, back state) TemplateListModel {
+	items := make([]list.Item, len(c.Templates))
+	for i, t := range c.Templates {
+		items[i] = templateItem{template: t}
+	}
+	lg := lipgloss.DefaultRenderer()
+	l := list.New(items, list.NewDefaultDelegate(), 0, 0)
+	l.SetShowHelp(false)
+	l.Title = "Templates"
+	return TemplateListModel{list: l, back: back, lg: lg, styles: NewStyles(lg)}
+}
+
+func (m TemplateListModel) Init() tea.Cmd {
+	return tea.WindowSize()
+}
+
+func (m TemplateListModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		UpdateWidth(&m, msg.Width)
+		h, v := m.styles.Base.GetFrameSize()
+		m.height = msg.Height - v
+		m.list.SetSize(min(msg.Width-h, maxWidth), msg.Height-v-listVerticalOffset)
+	case tea.KeyMsg:
+		switch {
+		case m.form != nil:
+			if msg.String() == "esc" {
+				m.form = nil
+				return m, nil
+			}
+		case m.list.FilterState() == list.Filtering:
+			break
+		default:
+			switch msg.String() {
+			case "esc", "ctrl+c", "q":
+				return m, m.leave
+			case "enter":
+				if selected, ok := m.list.SelectedItem().(templateItem); ok {
+					return m.fillIn(selected.template)
+				}
+				return m, nil
+			}
+		}
+	}
+
+	if m.form != nil {
+		form, cmd := m.form.Update(msg)
+		if f, ok := form.(*huh.Form); ok {
+			m.form = f
+		}
+		if m.form.State == huh.StateCompleted {
+			return m.send()
+		}
+		return m, cmd
+	}
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+// leave returns to the screen the list was opened from.
+func (m TemplateListModel) leave() tea.Msg {
+	return switchMsg(m.back)
+}
+
+// fillIn asks for the input and variables of t, or sends it straight away if
+// it has none.
+func (m TemplateListModel) fillIn(t meh.Template) (tea.Model, tea.Cmd) {
+	m.selected, m.err = t, nil
+	names, err := t.Variables()
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	var fields []huh.Field
+	if t.UsesInput() {
+		fields = append(fields, huh.NewText().
+			Key("input").
+			Title("Input").
+			Lines(6))
+	}
+	for _, name := range names {
+		value := t.Defaults[name]
+		fields = append(fields, huh.NewInput().
+			Key(variableKey(name)).
+			Value(&value).
+			Title(name))
+	}
+	if len(fields) == 0 {
+		return m.send()
+	}
+	m.form = huh.NewForm(huh.NewGroup(fields...).Title(t.Name)).
+		WithWidth(min(m.width, 80)).
+		WithShowHelp(false)
+	return m, m.form.Init()
+}
+
+// send fills in the selected template with the values entered in the form
+// and asks for it to be sent.
+func (m TemplateListModel) send() (tea.Model, tea.Cmd) {
+	vars := map[string]string{}
+	input := ""
+	if m.form != nil {
+		names, _ := m.selected.Variables()
+		for _, name := range names {
+			vars[name] = m.form.GetString(variableKey(name))
+		}
+		input = m.form.GetString("input")
+	}
+	m.form = nil
+	text, err := m.selected.Execute(input, vars)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	persona := m.selected.Persona
+	return m, func() tea.Msg { return templateMsg{text: text, persona: persona} }
+}
+
+func variableKey(name string) string {
+	return "var_" + name
+}
+
+func (m TemplateListModel) View() string {
+	s := m.styles
+	header := appBoundaryView(&m, "fill in a template")
+	footer := appBoundaryView(&m, "enter use • / filter • esc back")
+	if m.err != nil {
+		header = appErrorBoundaryView(&m, m.err.Error())
+	}
+	if m.form != nil {
+		footer = appBoundaryView(&m, "enter next • esc back to the list")
+		return s.Base.Render(header + "\n" + s.Base.Render(m.form.View()) + "\n\n" + footer)
+	}
+	if len(m.list.Items()) == 0 {
+		body := s.Base.Render("No templates yet. Add them under templates: in the config file (meh -c).")
+		return s.Base.Render(header + "\n" + body + "\n\n" + footer)
+	}
+	return s.Base.Render(header + "\n" + s.Base.Render(m.list.View()) + "\n\n" + footer)
+}
+
+func (m TemplateListModel) Height() int {
+	return m.height
+}
+func (m TemplateListModel) Width() int {
+	return m.width
+}
+
+func (m *TemplateListModel) SetHeight(height int) {
+	m.height = height
+}
+func (m *TemplateListModel) SetWidth(width int) {
+	m.width = width
+}
+
+func (m TemplateListModel) Styles() *Styles {
+	return m.styles
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cpcf/meh/pkg/meh"
+)
+
+// findTemplate returns the template called name, or an error listing the
+// templates there are.
+func findTemplate(conf *meh.Config, name string) (meh.Template, error) {
+	t, ok := conf.FindTemplate(name)
+	if !ok {
+		return meh.Template{}, fmt.Errorf("no template named %q, expected one of: %s", name, strings.Join(conf.TemplateNames(), ", "))
+	}
+	return t, nil
+}
+
+// fillTemplate fills in t from the command line, with input and the
+// variables given with -var. Variables given neither with -var nor a default
+// are asked for on the terminal.
+func fillTemplate(t meh.Template, input string, given map[string]string) (string, error) {
+	vars := map[string]string{}
+	for k, v := range given {
+		vars[k] = v
+	}
+	missing, err := t.Missing(vars)
+	if err != nil {
+		return "", err
+	}
+	if len(missing) > 0 {
+		if err := promptVariables(missing, vars); err != nil {
+			return "", err
+		}
+	}
+	return t.Execute(input, vars)
+}
+
+// promptVariables asks for the value of each of names on the terminal, which
+// is opened directly as stdin may hold the query's input.
+func promptVariables(names []string, vars map[string]string) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("missing template variables %s, set them with -var name=value", strings.Join(names, ", "))
+	}
+	defer tty.Close()
+	in := bufio.NewReader(tty)
+	for _, name := range names {
+		fmt.Fprintf(tty, "%s: ", name)
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return errors.New("template variables not given")
+		}
+		vars[name] = strings.TrimRight(line, "\r\n")
+	}
+	return nil
+}
@@ -1,11 +1,14 @@
 package client
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/cpcf/meh/internal/rag"
+	"github.com/cpcf/meh/pkg/meh"
 )
 
 type state int
@@ -15,6 +18,9 @@ const (
 	chatState
 	selectPersonaState
 	createPersonaState
+	sessionsState
+	modelManagerState
+	templatesState
 )
 const maxHeight = 1200
 const maxWidth = 400
@@ -26,43 +32,83 @@ type MainModel struct {
 	chatModel          ChatModel
 	createPersonaModel CreatePersonaModel
 	selectPersonaModel SelectPersonaModel
-	config             *Config
-	persona            Persona
+	sessionListModel   SessionListModel
+	modelManagerModel  ModelManagerModel
+	templateListModel  TemplateListModel
+	config             *meh.Config
+	persona            meh.Persona
+	raw                bool       // show replies as raw markdown
+	index              *rag.Index // searched for passages to add to messages, if set
+	chunks             int        // how many passages of index to add
 	styles             *Styles
 	width              int
 	height             int
 }
 
 type switchMsg state
-type personaMsg Persona
+type personaMsg meh.Persona
 
 func BackToMain() tea.Msg {
 	return switchMsg(mainState)
 }
 
-func setPersona(persona Persona) tea.Msg {
+func setPersona(persona meh.Persona) tea.Msg {
 	return personaMsg(persona)
 }
 
-func SetPersonaCmd(persona Persona) tea.Cmd {
+func SetPersonaCmd(persona meh.Persona) tea.Cmd {
 	return func() tea.Msg {
 		return personaMsg(persona)
 	}
 }
 
-func NewMainModel(c *Config, p Persona) MainModel {
+func NewMainModel(c *meh.Config, p meh.Persona, raw bool) MainModel {
 
 	m := MainModel{
 		currentState:       mainState,
 		config:             c,
 		createPersonaModel: NewCreatePersonaModel(c),
+		raw:                raw,
 		styles:             NewStyles(lipgloss.DefaultRenderer()),
 	}
 	m.persona = p
+	// Query the terminal's background for the markdown style now, as the
+	// answer would be garbled once the program is reading input.
+	lipgloss.HasDarkBackground()
+	return m
+}
+
+// WithIndex has chats search idx for k passages to add to each message.
+func (m MainModel) WithIndex(idx *rag.Index, k int) MainModel {
+	m.index, m.chunks = idx, k
+	return m
+}
+
+// newChat returns a chat with the current persona, resuming session if it is
+// not nil.
+func (m MainModel) newChat(session *Session) ChatModel {
+	chat := NewChatModel(m.persona, session, m.raw)
+	if m.index != nil {
+		chat.setIndex(m.index, m.chunks)
+	}
+	return chat
+}
+
+// ResumeSession opens the chat screen on a saved session, using the
+// session's persona if it still exists.
+func (m MainModel) ResumeSession(s *Session) MainModel {
+	if p, ok := m.config.FindPersona(s.Persona); ok {
+		m.persona = p
+	}
+	m.currentState = chatState
+	m.chatModel = m.newChat(s)
 	return m
 }
 
 func (m MainModel) Init() tea.Cmd {
+	if m.currentState == chatState {
+		return m.chatModel.Init()
+	}
 	return nil
 }
 
@@ -70,16 +116,45 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 	switch msg := msg.(type) {
 	case personaMsg:
-		m.persona = Persona(msg)
+		m.persona = meh.Persona(msg)
+	case sessionMsg:
+		m = m.ResumeSession(msg)
+		return m, m.chatModel.Init()
+	case openTemplatesMsg:
+		m.currentState = templatesState
+		m.templateListModel = NewTemplateListModel(m.config, chatState)
+		return m, m.templateListModel.Init()
+	case templateMsg:
+		var initCmd tea.Cmd
+		if m.templateListModel.back != chatState {
+			// Templates picked from the main menu start a new chat.
+			if p, ok := m.config.FindPersona(msg.persona); ok {
+				m.persona = p
+			}
+			m.chatModel = ChatModel{}
+			if !m.persona.IsZero() {
+				m.chatModel = m.newChat(nil)
+				initCmd = m.chatModel.Init()
+			}
+		}
+		m.currentState = chatState
+		var cmd tea.Cmd
+		m.chatModel, cmd = m.chatModel.sendPrompt(msg.text)
+		return m, tea.Batch(initCmd, cmd, tea.WindowSize())
+	case editPersonaMsg:
+		m.currentState = createPersonaState
+		m.createPersonaModel = NewEditPersonaModel(m.config, meh.Persona(msg))
+		return m, m.createPersonaModel.Init()
 	case switchMsg:
 		// Reload config when we switch
-		conf, err := LoadConfig()
-
-		if err != nil {
-			if _, ok := err.(ErrNoConfig); ok {
-				conf = &Config{}
-				SaveConfig(conf)
-			}
+		conf, err := meh.LoadConfig()
+		switch {
+		case errors.Is(err, meh.ErrNoConfig):
+			conf = &meh.Config{}
+			meh.SaveConfig(conf)
+		case err != nil:
+			// Keep the config we have rather than lose the personas.
+			conf = m.config
 		}
 
 		m.config = conf
@@ -100,6 +175,18 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		updatedModel, cmd := m.selectPersonaModel.Update(msg)
 		m.selectPersonaModel = updatedModel.(SelectPersonaModel)
 		cmds = append(cmds, cmd)
+	case sessionsState:
+		updatedModel, cmd := m.sessionListModel.Update(msg)
+		m.sessionListModel = updatedModel.(SessionListModel)
+		cmds = append(cmds, cmd)
+	case modelManagerState:
+		updatedModel, cmd := m.modelManagerModel.Update(msg)
+		m.modelManagerModel = updatedModel.(ModelManagerModel)
+		cmds = append(cmds, cmd)
+	case templatesState:
+		updatedModel, cmd := m.templateListModel.Update(msg)
+		m.templateListModel = updatedModel.(TemplateListModel)
+		cmds = append(cmds, cmd)
 	case mainState:
 		switch msg := msg.(type) {
 		case tea.KeyMsg:
@@ -108,8 +195,8 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				cmds = append(cmds, tea.Quit)
 			case "c":
 				m.currentState = chatState
-				if m.persona != (Persona{}) {
-					m.chatModel = NewChatModel(m.persona)
+				if !m.persona.IsZero() {
+					m.chatModel = m.newChat(nil)
 					cmds = append(cmds, m.chatModel.Init())
 				}
 			case "n":
@@ -118,8 +205,20 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				cmds = append(cmds, m.createPersonaModel.Init())
 			case "r":
 				m.currentState = selectPersonaState
-				m.selectPersonaModel = NewPersonaListModel(m.config.Personas, m.persona)
+				m.selectPersonaModel = NewPersonaListModel(m.config, m.persona)
 				cmds = append(cmds, m.selectPersonaModel.Init())
+			case "s":
+				m.currentState = sessionsState
+				m.sessionListModel = NewSessionListModel()
+				cmds = append(cmds, m.sessionListModel.Init())
+			case "m":
+				m.currentState = modelManagerState
+				m.modelManagerModel = NewModelManagerModel(m.persona)
+				cmds = append(cmds, m.modelManagerModel.Init())
+			case "t":
+				m.currentState = templatesState
+				m.templateListModel = NewTemplateListModel(m.config, mainState)
+				cmds = append(cmds, m.templateListModel.Init())
 			}
 		case tea.WindowSizeMsg:
 			UpdateWidth(&m, msg.Width)
@@ -138,6 +237,12 @@ func (m MainModel) View() string {
 		return m.selectPersonaModel.View()
 	case createPersonaState:
 		return m.createPersonaModel.View()
+	case sessionsState:
+		return m.sessionListModel.View()
+	case modelManagerState:
+		return m.modelManagerModel.View()
+	case templatesState:
+		return m.templateListModel.View()
 	}
 	return m.MainMenu()
 }
@@ -148,7 +253,7 @@ func (m MainModel) MainMenu() string {
 	status := CreateStatusBar(s, m.persona, m.width-statusMarginOffset, m.height-8, "Current Persona")
 
 	header := appBoundaryView(&m, "meh")
-	menu := "Main Menu:\n(c) Chat\n(r) List Personas\n(n) Create Persona\n(q) Quit"
+	menu := "Main Menu:\n(c) Chat\n(r) List Personas\n(n) Create Persona\n(s) Sessions\n(m) Models\n(t) Templates\n(q) Quit"
 	body := lipgloss.JoinHorizontal(lipgloss.Top, menu, status)
 
 	// TODO: Add help for the main menu
@@ -176,16 +281,17 @@ func (m MainModel) Styles() *Styles {
 	return m.styles
 }
 
-func CreateStatusBar(s *Styles, p Persona, width, height int, title string) string {
+func CreateStatusBar(s *Styles, p meh.Persona, width, height int, title string) string {
 	var status string
 	{
 		var (
-			name   string
-			url    string
-			model  string
-			prompt string
+			name    string
+			url     string
+			model   string
+			options string
+			prompt  string
 		)
-		if p != (Persona{}) {
+		if !p.IsZero() {
 			name = s.Highlight.Render("Name:  ")
 			url = s.Highlight.Render("URL:   ")
 			model = s.Highlight.Render("Model: ")
@@ -195,6 +301,9 @@ func CreateStatusBar(s *Styles, p Persona, width, height int, title string) stri
 			url = fmt.Sprintf("%s%s\n", url, p.APIURL)
 			model = fmt.Sprintf("%s%s\n", model, p.Model)
 			prompt = fmt.Sprintf("%s\n%s\n", prompt, strings.Split(p.SystemPrompt, "\n")[0])
+			if len(p.Options) > 0 {
+				options = fmt.Sprintf("%s\n%s\n", s.Highlight.Render("Options:"), p.Options)
+			}
 
 		}
 		h, v := s.Base.GetFrameSize()
@@ -207,7 +316,8 @@ func CreateStatusBar(s *Styles, p Persona, width, height int, title string) stri
 				name +
 				url +
 				model +
-				prompt)
+				prompt +
+				options)
 	}
 	return status
 }
@@ -0,0 +1,196 @@
+package ollama
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ContextStrategy decides what is sent of a conversation that has outgrown
+// the model's context window. With ContextFull the whole branch is sent and
+// the server cuts off whatever doesn't fit, which may be the system prompt.
+type ContextStrategy string
+
+const (
+	ContextFull      ContextStrategy = "full"      // send every message
+	ContextWindow    ContextStrategy = "window"    // send the latest messages that fit
+	ContextPin       ContextStrategy = "pin"       // as window, always keeping the system prompt
+	ContextSummarize ContextStrategy = "summarize" // as pin, summarizing the messages left out
+)
+
+var contextStrategies = []ContextStrategy{ContextFull, ContextWindow, ContextPin, ContextSummarize}
+
+// ContextStrategies returns the names of the context strategies.
+func ContextStrategies() []string {
+	names := make([]string, len(contextStrategies))
+	for i, s := range contextStrategies {
+		names[i] = string(s)
+	}
+	return names
+}
+
+// ParseContextStrategy returns the named context strategy. An empty name is
+// ContextFull.
+func ParseContextStrategy(name string) (ContextStrategy, error) {
+	if name == "" {
+		return ContextFull, nil
+	}
+	for _, s := range contextStrategies {
+		if string(s) == name {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown context strategy %q, expected one of %s", name, strings.Join(ContextStrategies(), ", "))
+}
+
+// DefaultNumCtx is the context window Ollama gives a model when the num_ctx
+// option isn't set.
+const DefaultNumCtx = 2048
+
+// imageTokens is roughly what an image takes up in a vision model's context.
+const imageTokens = 768
+
+// summaryPrompt is the system prompt of the request summarizing the messages
+// left out of the context window.
+const summaryPrompt = `You summarize conversations between a user and an assistant so they can be continued without the full transcript. Keep the facts, decisions, names, code and open questions that later messages may refer to. Reply with the summary only.`
+
+// EstimateTokens guesses how many tokens m takes up in the context window,
+// at about four characters a token.
+func EstimateTokens(m Message) int {
+	n := 4 + (len(m.Content)+3)/4 + len(m.Images)*imageTokens
+	for _, call := range m.ToolCalls {
+		n += (len(call.String()) + 3) / 4
+	}
+	return n
+}
+
+// SetContextStrategy sets how conversations that outgrow the context window
+// are cut down before they are sent.
+func (o *OllamaAPI) SetContextStrategy(s ContextStrategy) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.strategy = s
+}
+
+// summary is the summary of the start of a branch, kept so the same
+// messages aren't summarized on every request.
+type summary struct {
+	node int // index in the tree's nodes of the last message summarized
+	text string
+}
+
+// contextBudget returns how many tokens of the conversation can be sent with
+// options, leaving room in the context window for the reply.
+func contextBudget(options Options) int {
+	size := options.Int("num_ctx")
+	if size <= 0 {
+		size = DefaultNumCtx
+	}
+	reserve := options.Int("num_predict")
+	if reserve <= 0 || reserve > size/2 {
+		reserve = size / 4
+	}
+	return size - reserve
+}
+
+// fitContext returns the messages of the current branch to send, cut down to
+// the context window by the context strategy, and how many of them were left
+// out. It fails only if ctx is cancelled. o.turn must be held.
+func (o *OllamaAPI) fitContext(ctx context.Context, s settings) ([]Message, int, error) {
+	branch := o.history.Branch()
+	if s.strategy == "" || s.strategy == ContextFull {
+		return branch, 0, nil
+	}
+	budget := contextBudget(s.options)
+	pinned := 0
+	if s.strategy != ContextWindow && len(branch) > 0 && branch[0].Role == "system" {
+		pinned = 1
+		budget -= EstimateTokens(branch[0])
+	}
+	summaryLimit := 0
+	if s.strategy == ContextSummarize {
+		summaryLimit = budget / 4
+		budget -= summaryLimit
+	}
+	start := pinned + windowStart(branch[pinned:], budget)
+	if start == pinned {
+		return branch, 0, nil
+	}
+
+	messages := append([]Message(nil), branch[:pinned]...)
+	if s.strategy == ContextSummarize {
+		// If summarizing fails the messages are just left out.
+		text, err := o.summarize(ctx, s, pinned, start, summaryLimit)
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		if err == nil {
+			messages = append(messages, Message{Role: "system", Content: "Summary of the earlier conversation:\n" + text})
+		}
+	}
+	return append(messages, branch[start:]...), start - pinned, nil
+}
+
+// windowStart returns the index of the first of the latest messages that fit
+// in budget tokens, or 0 if they all do. The window starts at a user message,
+// so replies and tool results aren't sent without what they answer, and
+// always holds the last one.
+func windowStart(messages []Message, budget int) int {
+	last := -1
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			last = i
+			break
+		}
+	}
+	start, total := 0, 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		total += EstimateTokens(messages[i])
+		if total > budget && i < last {
+			return start
+		}
+		if messages[i].Role == "user" {
+			start = i
+		}
+	}
+	return 0
+}
+
+// summarize returns a summary of the messages from index from up to to of
+// the current branch, no longer than limit tokens, building on the summary
+// of an earlier part of them if there is one. o.turn must be held.
+func (o *OllamaAPI) summarize(ctx context.Context, s settings, from, to, limit int) (string, error) {
+	path := o.history.path()
+	branch := o.history.Branch()
+	if o.summary.text != "" && o.summary.node == path[to-1] {
+		return o.summary.text, nil
+	}
+
+	var b strings.Builder
+	for i := from; i < to-1; i++ {
+		if o.summary.text != "" && path[i] == o.summary.node {
+			fmt.Fprintf(&b, "Summary of the conversation so far:\n%s\n\nThe conversation since:\n\n", o.summary.text)
+			from = i + 1
+		}
+	}
+	for _, m := range branch[from:to] {
+		fmt.Fprintf(&b, "%s: %s\n\n", m.Role, m.Content)
+	}
+
+	req := Request{
+		Model:   s.model,
+		System:  summaryPrompt,
+		Prompt:  b.String(),
+		Options: s.options.Merge(Options{"num_predict": limit}),
+	}
+	resp, err := o.sendRequest(ctx, o.baseURL+"/generate", req)
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimSpace(resp.Response)
+	if text == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	o.summary = summary{node: path[to-1], text: text}
+	return text, nil
+}
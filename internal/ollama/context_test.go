@@ -0,0 +1,167 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// message returns a message whose content is 40 characters, 14 tokens by
+// EstimateTokens.
+func message(role, name string) Message {
+	return Message{Role: role, Content: name + strings.Repeat(".", 40-len(name))}
+}
+
+// conversation is a system prompt and 5 messages, 84 tokens in all. With a
+// num_ctx of 100, 75 tokens are left for it.
+var conversation = []Message{
+	message("system", "sys"),
+	message("user", "q1"),
+	message("assistant", "a1"),
+	message("user", "q2"),
+	message("assistant", "a2"),
+	message("user", "q3"),
+}
+
+func names(messages []Message) []string {
+	out := make([]string, len(messages))
+	for i, m := range messages {
+		out[i] = strings.TrimRight(m.Content, ".")
+	}
+	return out
+}
+
+func newContextAPI(url string, strategy ContextStrategy) *OllamaAPI {
+	o := NewAPI(url, "llama3", "")
+	o.SetOptions(Options{"num_ctx": 100})
+	o.SetContextStrategy(strategy)
+	o.SetHistory(conversation)
+	return o
+}
+
+func TestWindowStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []Message
+		budget   int
+		want     int
+	}{
+		{"all fit", conversation[1:], 100, 0},
+		{"starts at a user message", conversation[1:], 30, 4},
+		{"drops whole exchanges", conversation[1:], 60, 2},
+		{"keeps the last user message", []Message{message("user", "q1"), {Role: "user", Content: strings.Repeat(".", 400)}}, 20, 1},
+		{"keeps the replies to it", []Message{message("user", "q1"), message("user", "q2"), message("assistant", "a2"), message("assistant", "a2'")}, 20, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := windowStart(tt.messages, tt.budget); got != tt.want {
+				t.Errorf("windowStart(%q, %d) = %d, want %d", names(tt.messages), tt.budget, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFitContext(t *testing.T) {
+	tests := []struct {
+		strategy    ContextStrategy
+		want        []string
+		wantDropped int
+	}{
+		{ContextFull, []string{"sys", "q1", "a1", "q2", "a2", "q3"}, 0},
+		{ContextWindow, []string{"q1", "a1", "q2", "a2", "q3"}, 1},
+		{ContextPin, []string{"sys", "q2", "a2", "q3"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			o := newContextAPI("http://localhost:0", tt.strategy)
+			messages, dropped, err := o.fitContext(context.Background(), o.settings())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(messages); !slices.Equal(got, tt.want) || dropped != tt.wantDropped {
+				t.Errorf("fitContext() = %q, %d, want %q, %d", got, dropped, tt.want, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestFitContextSummarize(t *testing.T) {
+	var prompts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		json.NewDecoder(r.Body).Decode(&req)
+		prompts = append(prompts, req.Prompt)
+		json.NewEncoder(w).Encode(Response{Response: " the summary ", Done: true})
+	}))
+	defer srv.Close()
+
+	o := newContextAPI(srv.URL, ContextSummarize)
+	o.turn.Lock()
+	defer o.turn.Unlock()
+	for range 2 {
+		messages, dropped, err := o.fitContext(context.Background(), o.settings())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"sys", "Summary of the earlier conversation:\nthe summary", "q2", "a2", "q3"}
+		if got := names(messages); !slices.Equal(got, want) || dropped != 2 {
+			t.Errorf("fitContext() = %q, %d, want %q, 2", got, dropped, want)
+		}
+	}
+	// The summary is kept for the next request.
+	if len(prompts) != 1 {
+		t.Fatalf("sent %d summary requests, want 1", len(prompts))
+	}
+	if !strings.Contains(prompts[0], "user: q1") || !strings.Contains(prompts[0], "assistant: a1") || strings.Contains(prompts[0], "q2") {
+		t.Errorf("summary prompt = %q, want q1 and a1 only", prompts[0])
+	}
+}
+
+func TestFitContextSummarizeUnlocked(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		json.NewEncoder(w).Encode(Response{Response: "the summary", Done: true})
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	o := newContextAPI(srv.URL, ContextSummarize)
+	ctx, cancel := context.WithCancel(context.Background())
+	s := o.settings()
+	errc := make(chan error, 1)
+	go func() {
+		o.turn.Lock()
+		defer o.turn.Unlock()
+		_, _, err := o.fitContext(ctx, s)
+		errc <- err
+	}()
+	<-started
+
+	// Settings can be changed while the summary is generated, but the
+	// history stays locked.
+	if !o.mu.TryLock() {
+		t.Error("mu is held while summarizing")
+	} else {
+		o.mu.Unlock()
+	}
+	if o.turn.TryLock() {
+		t.Error("turn isn't held while summarizing")
+		o.turn.Unlock()
+	}
+
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("fitContext() after cancel = %v, want %v", err, context.Canceled)
+	}
+}
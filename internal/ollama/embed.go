@@ -0,0 +1,91 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// DefaultEmbedBatch is how many inputs Embed sends per request unless
+// SetEmbedOptions says otherwise.
+const DefaultEmbedBatch = 32
+
+// EmbedOptions controls how Embed sends its inputs.
+type EmbedOptions struct {
+	BatchSize  int  // inputs sent per request, all of them at once if 0
+	Truncate   bool // cut inputs longer than the model's context down to fit rather than fail
+	Dimensions int  // shorten embeddings to this size, for models that support it; 0 keeps them whole
+}
+
+// EmbedRequest is the body of POST /embed.
+type EmbedRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Truncate   *bool    `json:"truncate,omitempty"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+// EmbedResponse is the response from POST /embed, holding an embedding for
+// each input in order.
+type EmbedResponse struct {
+	Model      string      `json:"model"`
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// SetEmbedOptions sets how Embed batches and truncates its inputs.
+func (o *OllamaAPI) SetEmbedOptions(opts EmbedOptions) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.embed = opts
+}
+
+// Embed returns the embeddings of input using the /embed endpoint, computed
+// by model, or by the API's model if model is empty. The inputs are sent in
+// batches as set by SetEmbedOptions.
+func (o *OllamaAPI) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	o.mu.Lock()
+	opts := o.embed
+	if model == "" {
+		model = o.model
+	}
+	o.mu.Unlock()
+
+	size := opts.BatchSize
+	if size <= 0 {
+		size = len(input)
+	}
+	embeddings := make([][]float32, 0, len(input))
+	for start := 0; start < len(input); start += size {
+		batch := input[start:min(start+size, len(input))]
+		req := EmbedRequest{Model: model, Input: batch, Truncate: &opts.Truncate, Dimensions: opts.Dimensions}
+		vectors, err := o.embedBatch(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, vectors...)
+	}
+	return embeddings, nil
+}
+
+// embedBatch sends a single request to the /embed endpoint.
+func (o *OllamaAPI) embedBatch(ctx context.Context, req EmbedRequest) ([][]float32, error) {
+	httpResp, err := o.post(ctx, o.baseURL+"/embed", req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, statusError(httpResp)
+	}
+
+	var resp EmbedResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(resp.Embeddings) != len(req.Input) {
+		return nil, fmt.Errorf("got %d embeddings for %d inputs", len(resp.Embeddings), len(req.Input))
+	}
+	return resp.Embeddings, nil
+}
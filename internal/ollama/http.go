@@ -0,0 +1,246 @@
+package ollama
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultRetryBackoff is how long the first retry waits when HTTPOptions
+// doesn't say. Each further retry waits twice as long as the one before.
+const DefaultRetryBackoff = 500 * time.Millisecond
+
+// HTTPOptions configures how requests reach an API: timeouts, retries,
+// extra headers, TLS and a proxy. The zero value uses Go's defaults.
+type HTTPOptions struct {
+	// ConnectTimeout limits how long connecting to the server may take.
+	ConnectTimeout time.Duration `yaml:"connect_timeout,omitempty"`
+	// ReadTimeout limits how long the server may take to respond, and to send
+	// more of a streamed reply. Models that are slow to load need a long one.
+	ReadTimeout time.Duration `yaml:"read_timeout,omitempty"`
+	// Retries is how many times a request is retried after failing to
+	// connect, or after a 5xx response if it is safe to repeat, see
+	// MarkIdempotent. RetryBackoff, doubled each time, is waited in between.
+	Retries      int           `yaml:"retries,omitempty"`
+	RetryBackoff time.Duration `yaml:"retry_backoff,omitempty"`
+	// Headers are added to every request, e.g. an Authorization header for a
+	// server behind a reverse proxy. $VAR and ${VAR} in values are replaced
+	// with environment variables, to keep tokens out of the config file.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// CACert is a PEM bundle of certificates to trust besides the system's.
+	CACert string `yaml:"ca_cert,omitempty"`
+	// ClientCert and ClientKey are PEM files of a certificate to present to
+	// servers that require one.
+	ClientCert string `yaml:"client_cert,omitempty"`
+	ClientKey  string `yaml:"client_key,omitempty"`
+	// InsecureSkipVerify accepts any certificate the server presents.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty"`
+	// Proxy is the URL of an HTTP proxy. If it is empty the HTTP_PROXY,
+	// HTTPS_PROXY and NO_PROXY environment variables are used.
+	Proxy string `yaml:"proxy,omitempty"`
+}
+
+// IsZero reports whether no HTTP settings are set.
+func (h HTTPOptions) IsZero() bool {
+	return h.ConnectTimeout == 0 && h.ReadTimeout == 0 && h.Retries == 0 && h.RetryBackoff == 0 &&
+		len(h.Headers) == 0 && h.CACert == "" && h.ClientCert == "" && h.ClientKey == "" &&
+		!h.InsecureSkipVerify && h.Proxy == ""
+}
+
+// NewHTTPClient returns an HTTP client configured with opts. It has no
+// overall timeout, as replies may stream for as long as the model generates.
+func NewHTTPClient(opts HTTPOptions) (*http.Client, error) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.ConnectTimeout > 0 {
+		dialer := &net.Dialer{Timeout: opts.ConnectTimeout, KeepAlive: 30 * time.Second}
+		base.DialContext = dialer.DialContext
+		base.TLSHandshakeTimeout = opts.ConnectTimeout
+	}
+	base.ResponseHeaderTimeout = opts.ReadTimeout
+	if opts.Proxy != "" {
+		proxy, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+		base.Proxy = http.ProxyURL(proxy)
+	}
+	tlsConfig, err := opts.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	base.TLSClientConfig = tlsConfig
+
+	headers := make(http.Header, len(opts.Headers))
+	for name, value := range opts.Headers {
+		headers.Set(name, os.ExpandEnv(value))
+	}
+	backoff := opts.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	return &http.Client{Transport: &transport{
+		base:        base,
+		headers:     headers,
+		retries:     opts.Retries,
+		backoff:     backoff,
+		readTimeout: opts.ReadTimeout,
+	}}, nil
+}
+
+// tlsConfig builds the TLS settings of opts, or returns nil if there are none.
+func (h HTTPOptions) tlsConfig() (*tls.Config, error) {
+	if h.CACert == "" && h.ClientCert == "" && h.ClientKey == "" && !h.InsecureSkipVerify {
+		return nil, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: h.InsecureSkipVerify}
+	if h.CACert != "" {
+		pem, err := os.ReadFile(h.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s holds no PEM certificates", h.CACert)
+		}
+		config.RootCAs = pool
+	}
+	if h.ClientCert != "" || h.ClientKey != "" {
+		if h.ClientCert == "" || h.ClientKey == "" {
+			return nil, errors.New("client_cert and client_key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(h.ClientCert, h.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// MarkIdempotent marks a request that may be sent again after a 5xx response,
+// as its method doesn't say so. It follows net/http's convention of an
+// Idempotency-Key header, which a nil value keeps from being sent.
+func MarkIdempotent(req *http.Request) {
+	req.Header["Idempotency-Key"] = nil
+}
+
+// idempotent reports whether sending req twice is no different from sending
+// it once.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	_, ok := req.Header["Idempotency-Key"]
+	return ok
+}
+
+// dialError reports whether err is a failure to connect, which means the
+// server never saw the request. TLS and proxy errors aren't, and wouldn't go
+// away on a retry.
+func dialError(err error) bool {
+	var opErr *net.OpError
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// transport adds headers to requests, retries those that fail to connect or
+// are safe to repeat after a 5xx response, and stops replies that stall.
+type transport struct {
+	base        http.RoundTripper
+	headers     http.Header
+	retries     int
+	backoff     time.Duration
+	readTimeout time.Duration
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	wait := t.backoff
+	for attempt := 0; ; attempt++ {
+		r := req.Clone(ctx)
+		for name, values := range t.headers {
+			r.Header[name] = values
+		}
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+		resp, err := t.base.RoundTrip(r)
+		retry := dialError(err) || err == nil && resp.StatusCode >= http.StatusInternalServerError && idempotent(req)
+		if !retry || attempt >= t.retries || ctx.Err() != nil || (req.Body != nil && req.GetBody == nil) {
+			if err == nil && t.readTimeout > 0 {
+				resp.Body = newIdleBody(resp.Body, t.readTimeout)
+			}
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		wait *= 2
+	}
+}
+
+// errReadTimeout is reported when a reply stalls for longer than the read
+// timeout.
+var errReadTimeout = errors.New("read timeout, the server stopped responding")
+
+// idleBody closes a response body that goes without data for longer than
+// timeout, failing the read waiting on it.
+type idleBody struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	mu      sync.Mutex
+	expired bool
+}
+
+func newIdleBody(body io.ReadCloser, timeout time.Duration) *idleBody {
+	b := &idleBody{body: body, timeout: timeout}
+	b.timer = time.AfterFunc(timeout, func() {
+		b.mu.Lock()
+		b.expired = true
+		b.mu.Unlock()
+		body.Close()
+	})
+	b.timer.Stop()
+	return b
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	// Only time spent waiting on the server counts.
+	b.timer.Reset(b.timeout)
+	n, err := b.body.Read(p)
+	b.timer.Stop()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil && b.expired {
+		return n, errReadTimeout
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.timer.Stop()
+	return b.body.Close()
+}
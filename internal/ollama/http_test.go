@@ -0,0 +1,230 @@
+package ollama
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer fails the first failures requests with status, then answers
+// "ok". It counts the requests it gets.
+func flakyServer(t *testing.T, failures int, status int) (*httptest.Server, *atomic.Int32) {
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if int(n.Add(1)) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &n
+}
+
+func newTestClient(t *testing.T, opts HTTPOptions) *http.Client {
+	t.Helper()
+	if opts.RetryBackoff == 0 {
+		opts.RetryBackoff = time.Millisecond
+	}
+	client, err := NewHTTPClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestRetries(t *testing.T) {
+	post := func(idempotent bool) func(url string) *http.Request {
+		return func(url string) *http.Request {
+			req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(`{}`))
+			if idempotent {
+				MarkIdempotent(req)
+			}
+			return req
+		}
+	}
+	get := func(url string) *http.Request {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		return req
+	}
+	tests := []struct {
+		name         string
+		status       int
+		request      func(url string) *http.Request
+		wantStatus   int
+		wantRequests int32
+	}{
+		{"GET after 503", http.StatusServiceUnavailable, get, http.StatusOK, 3},
+		{"marked POST after 500", http.StatusInternalServerError, post(true), http.StatusOK, 3},
+		{"POST after 503", http.StatusServiceUnavailable, post(false), http.StatusServiceUnavailable, 1},
+		{"GET after 404", http.StatusNotFound, get, http.StatusNotFound, 1},
+		{"marked POST after 400", http.StatusBadRequest, post(true), http.StatusBadRequest, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, n := flakyServer(t, 2, tt.status)
+			client := newTestClient(t, HTTPOptions{Retries: 3})
+			resp, err := client.Do(tt.request(srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus || n.Load() != tt.wantRequests {
+				t.Errorf("got %d after %d requests, want %d after %d", resp.StatusCode, n.Load(), tt.wantStatus, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetriesGiveUp(t *testing.T) {
+	srv, n := flakyServer(t, 10, http.StatusBadGateway)
+	client := newTestClient(t, HTTPOptions{Retries: 2})
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || n.Load() != 3 {
+		t.Errorf("got %d after %d requests, want 502 after 3", resp.StatusCode, n.Load())
+	}
+}
+
+func TestRetryConnectionRefused(t *testing.T) {
+	// Take a free port and close it, so connecting to it is refused.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	client := newTestClient(t, HTTPOptions{Retries: 2, RetryBackoff: 20 * time.Millisecond})
+	start := time.Now()
+	_, err = client.Get("http://" + addr)
+	if !dialError(err) {
+		t.Fatalf("Get() = %v, want a dial error", err)
+	}
+	// Two retries wait 20ms and 40ms.
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("gave up after %v, want at least 60ms of retries", elapsed)
+	}
+}
+
+func TestNoRetryOnTLSError(t *testing.T) {
+	var n atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			n.Add(1)
+		}
+	}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	// The test server's certificate isn't trusted.
+	client := newTestClient(t, HTTPOptions{Retries: 3})
+	if _, err := client.Get(srv.URL); err == nil || dialError(err) {
+		t.Fatalf("Get() = %v, want a certificate error", err)
+	}
+	if n.Load() != 1 {
+		t.Errorf("connected %d times, want 1", n.Load())
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first")
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := newTestClient(t, HTTPOptions{ReadTimeout: 50 * time.Millisecond})
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if !errors.Is(err, errReadTimeout) {
+		t.Errorf("reading a stalled body = %v, want %v", err, errReadTimeout)
+	}
+	if string(body) != "first" {
+		t.Errorf("body = %q, want what arrived before the stall", body)
+	}
+}
+
+func TestReadTimeoutSlowReader(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("x", 10))
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, HTTPOptions{ReadTimeout: 20 * time.Millisecond})
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// Time spent between reads isn't the server's, so doesn't count.
+	time.Sleep(60 * time.Millisecond)
+	if body, err := io.ReadAll(resp.Body); err != nil || len(body) != 10 {
+		t.Errorf("ReadAll() = %q, %v, want the whole body", body, err)
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	t.Setenv("MEH_TEST_TOKEN", "secret")
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, HTTPOptions{Headers: map[string]string{
+		"Authorization": "Bearer $MEH_TEST_TOKEN",
+		"X-Team":        "${MEH_TEST_TOKEN}-team",
+	}})
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{}`))
+	MarkIdempotent(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if v := got.Get("Authorization"); v != "Bearer secret" {
+		t.Errorf("Authorization = %q, want %q", v, "Bearer secret")
+	}
+	if v := got.Get("X-Team"); v != "secret-team" {
+		t.Errorf("X-Team = %q, want %q", v, "secret-team")
+	}
+	if _, ok := got["Idempotency-Key"]; ok {
+		t.Error("the Idempotency-Key marker was sent")
+	}
+}
+
+func TestHTTPOptionsErrors(t *testing.T) {
+	for _, opts := range []HTTPOptions{
+		{Proxy: "://bad"},
+		{CACert: "/nonexistent/ca.pem"},
+		{ClientCert: "cert.pem"},
+	} {
+		if _, err := NewHTTPClient(opts); err == nil {
+			t.Errorf("NewHTTPClient(%+v) = nil error", opts)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package ollama
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// LoadImage reads a PNG or JPEG file and returns it base64 encoded, ready to
+// attach to a message.
+func LoadImage(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading image: %w", err)
+	}
+	switch http.DetectContentType(data) {
+	case "image/png", "image/jpeg":
+	default:
+		return "", fmt.Errorf("%s is not a PNG or JPEG image", filepath.Base(path))
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// checkVision returns an error if model is known not to accept images.
+// Servers too old to report capabilities are given the benefit of the doubt.
+func (o *OllamaAPI) checkVision(ctx context.Context, model string) error {
+	info, err := o.Show(ctx, model)
+	if err != nil {
+		return err
+	}
+	if len(info.Capabilities) > 0 && !slices.Contains(info.Capabilities, "vision") {
+		return fmt.Errorf("model %s does not support images", model)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ModelDetails describes a model's format, family and size.
+type ModelDetails struct {
+	Format            string `json:"format"`
+	Family            string `json:"family"`
+	ParameterSize     string `json:"parameter_size"`
+	QuantizationLevel string `json:"quantization_level"`
+}
+
+// ModelInfo is a local model as listed by GET /tags.
+type ModelInfo struct {
+	Name       string       `json:"name"`
+	Model      string       `json:"model"`
+	ModifiedAt time.Time    `json:"modified_at"`
+	Size       int64        `json:"size"`
+	Digest     string       `json:"digest"`
+	Details    ModelDetails `json:"details"`
+}
+
+// RunningModel is a model loaded in memory as listed by GET /ps.
+type RunningModel struct {
+	Name      string       `json:"name"`
+	Model     string       `json:"model"`
+	Size      int64        `json:"size"`
+	SizeVRAM  int64        `json:"size_vram"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	Details   ModelDetails `json:"details"`
+}
+
+// ShowResponse is the response from POST /show.
+type ShowResponse struct {
+	License      string                 `json:"license,omitempty"`
+	Modelfile    string                 `json:"modelfile,omitempty"`
+	Parameters   string                 `json:"parameters,omitempty"`
+	Template     string                 `json:"template,omitempty"`
+	Details      ModelDetails           `json:"details"`
+	ModelInfo    map[string]interface{} `json:"model_info,omitempty"`
+	Capabilities []string               `json:"capabilities,omitempty"`
+}
+
+// PullProgress reports the state of a model download. Total and Completed
+// are byte counts for the layer identified by Digest, when one is in flight.
+type PullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ListModels retrieves the local models using the /tags endpoint.
+func (o *OllamaAPI) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var resp struct {
+		Models []ModelInfo `json:"models"`
+	}
+	if err := o.get(ctx, "/tags", &resp); err != nil {
+		return nil, err
+	}
+	return resp.Models, nil
+}
+
+// Running retrieves the models loaded in memory using the /ps endpoint.
+func (o *OllamaAPI) Running(ctx context.Context) ([]RunningModel, error) {
+	var resp struct {
+		Models []RunningModel `json:"models"`
+	}
+	if err := o.get(ctx, "/ps", &resp); err != nil {
+		return nil, err
+	}
+	return resp.Models, nil
+}
+
+// Show retrieves details of a model using the /show endpoint.
+func (o *OllamaAPI) Show(ctx context.Context, model string) (*ShowResponse, error) {
+	httpResp, err := o.post(ctx, o.baseURL+"/show", map[string]string{"model": model})
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, statusError(httpResp)
+	}
+
+	var resp ShowResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &resp, nil
+}
+
+// Pull downloads a model using the /pull endpoint, sending progress updates
+// to progress as they arrive. progress is closed when Pull returns.
+func (o *OllamaAPI) Pull(ctx context.Context, model string, progress chan<- PullProgress) error {
+	defer close(progress)
+	httpResp, err := o.sendJSON(ctx, http.MethodPost, o.baseURL+"/pull", map[string]interface{}{"model": model, "stream": true}, false)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return statusError(httpResp)
+	}
+
+	decoder := json.NewDecoder(httpResp.Body)
+	for {
+		var p PullProgress
+		if err := decoder.Decode(&p); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		if p.Error != "" {
+			return errors.New(p.Error)
+		}
+		select {
+		case progress <- p:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Delete removes a local model using the /delete endpoint.
+func (o *OllamaAPI) Delete(ctx context.Context, model string) error {
+	return o.do(ctx, http.MethodDelete, "/delete", map[string]string{"model": model})
+}
+
+// Copy duplicates a local model under a new name using the /copy endpoint.
+func (o *OllamaAPI) Copy(ctx context.Context, source, destination string) error {
+	return o.do(ctx, http.MethodPost, "/copy", map[string]string{"source": source, "destination": destination})
+}
+
+// get decodes the JSON response to a GET of the endpoint into resp.
+func (o *OllamaAPI) get(ctx context.Context, endpoint string, resp interface{}) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, o.baseURL+endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpResp, err := o.client.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return statusError(httpResp)
+	}
+	if err := json.NewDecoder(httpResp.Body).Decode(resp); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// do sends req to the endpoint for its status alone.
+func (o *OllamaAPI) do(ctx context.Context, method, endpoint string, req interface{}) error {
+	httpResp, err := o.sendJSON(ctx, method, o.baseURL+endpoint, req, false)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return statusError(httpResp)
+	}
+	return nil
+}
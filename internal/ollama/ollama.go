@@ -2,35 +2,44 @@ package ollama
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 )
 
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Images    []string   `json:"images,omitempty"`     // base64 encoded, for multimodal models
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"` // tools the assistant asked to run
+	ToolName  string     `json:"tool_name,omitempty"`  // the tool whose result a "tool" message holds
 }
 
 func (m Message) String() string {
-	return fmt.Sprintf("Message{role: %s, Content: %s}", m.Role, m.Content)
+	return fmt.Sprintf("Message{role: %s, Content: %s, Images: %d}", m.Role, m.Content, len(m.Images))
 }
 
 // Request represents a call to the LLM API. It supports both chat and completion requests.
 type Request struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages,omitempty"` // for chat requests
-	Prompt   string    `json:"prompt,omitempty"`   // for generate (completion) requests
-	System   string    `json:"system,omitempty"`   // optional: for completions with a system prompt
-	Suffix   string    `json:"suffix,omitempty"`   // optional: for completions with a suffix
-	Stream   bool      `json:"stream"`
+	Model    string          `json:"model"`
+	Messages []Message       `json:"messages,omitempty"` // for chat requests
+	Prompt   string          `json:"prompt,omitempty"`   // for generate (completion) requests
+	System   string          `json:"system,omitempty"`   // optional: for completions with a system prompt
+	Suffix   string          `json:"suffix,omitempty"`   // optional: for completions with a suffix
+	Images   []string        `json:"images,omitempty"`   // optional: for completions about images
+	Options  Options         `json:"options,omitempty"`  // optional: generation parameters
+	Format   json.RawMessage `json:"format,omitempty"`   // optional: "json" or a JSON schema
+	Tools    []Tool          `json:"tools,omitempty"`    // optional: for chat requests
+	Stream   bool            `json:"stream"`
 }
 
 func (r Request) String() string {
-	return fmt.Sprintf("Request{Model: %s, Messages: %v, Prompt: %s, Suffix: %s, Stream: %t}", r.Model, r.Messages, r.Prompt, r.Suffix, r.Stream)
+	return fmt.Sprintf("Request{Model: %s, Messages: %v, Prompt: %s, Suffix: %s, Options: %v, Stream: %t}", r.Model, r.Messages, r.Prompt, r.Suffix, r.Options, r.Stream)
 }
 
 type Response struct {
@@ -49,25 +58,84 @@ type Response struct {
 	Context            interface{} `json:"context,omitempty"`
 }
 
+// Stats returns the token counts and timings reported with the final response.
+func (r Response) Stats() Stats {
+	return Stats{
+		PromptEvalCount:    r.PromptEvalCount,
+		PromptEvalDuration: time.Duration(r.PromptEvalDuration),
+		EvalCount:          r.EvalCount,
+		EvalDuration:       time.Duration(r.EvalDuration),
+		LoadDuration:       time.Duration(r.LoadDuration),
+		TotalDuration:      time.Duration(r.TotalDuration),
+	}
+}
+
 func (r Response) String() string {
 	return fmt.Sprintf("Response{Model: %s, CreatedAt: %s, Message: %v, Response: %s, Done: %t, DoneReason: %s, TotalDuration: %d, LoadDuration: %d, PromptEvalCount: %d, PromptEvalDuration: %d, EvalCount: %d, EvalDuration: %d, Context: %v}", r.Model, r.CreatedAt, r.Message, r.Response, r.Done, r.DoneReason, r.TotalDuration, r.LoadDuration, r.PromptEvalCount, r.PromptEvalDuration, r.EvalCount, r.EvalDuration, r.Context)
 }
 
-// SendRequest sends a non-streaming HTTP POST request to the given endpoint.
-func sendRequest(url string, req Request) (*Response, error) {
-	js, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+// EventKind identifies what a streamed Event carries.
+type EventKind int
+
+const (
+	TokenEvent      EventKind = iota // a chunk of generated text in Content
+	DoneEvent                        // the reply is complete; Stats is set
+	ErrorEvent                       // the request failed; Err is set
+	ToolCallEvent                    // the model called a tool; Call is set
+	ToolResultEvent                  // a tool returned Content for Call
+)
+
+// Event is a single item on a Chat or Prompt result stream.
+type Event struct {
+	Kind    EventKind
+	Content string
+	Stats   Stats
+	Err     error
+	Call    ToolCall
+	// Approve is set on a ToolCallEvent when the tool may only run with the
+	// user's approval. The receiver must send true to run it or false to
+	// decline.
+	Approve chan<- bool
+}
+
+// Stats holds the token counts and timings Ollama reports once a reply is done.
+type Stats struct {
+	PromptEvalCount    int
+	PromptEvalDuration time.Duration
+	EvalCount          int
+	EvalDuration       time.Duration
+	LoadDuration       time.Duration
+	TotalDuration      time.Duration
+	// Dropped counts the earlier messages left out of the request, or
+	// summarized, to fit the context window.
+	Dropped int
+}
+
+// TokensPerSecond returns how fast the reply was generated, or 0 if the
+// timing isn't known.
+func (s Stats) TokensPerSecond() float64 {
+	if s.EvalDuration <= 0 {
+		return 0
 	}
+	return float64(s.EvalCount) / s.EvalDuration.Seconds()
+}
 
-	httpResp, err := http.Post(url, "application/json", bytes.NewReader(js))
+// ErrClosed is reported when a request is made after Verify failed to reach the API.
+var ErrClosed = errors.New("API is closed")
+
+// ErrNoMessage is reported when a reply is regenerated before any message was sent.
+var ErrNoMessage = errors.New("no message to reply to")
+
+// SendRequest sends a non-streaming HTTP POST request to the given endpoint.
+func (o *OllamaAPI) sendRequest(ctx context.Context, url string, req Request) (*Response, error) {
+	httpResp, err := o.post(ctx, url, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
 	defer httpResp.Body.Close()
 
 	if httpResp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected response status: %s", httpResp.Status)
+		return nil, statusError(httpResp)
 	}
 
 	var apiResp Response
@@ -78,18 +146,19 @@ func sendRequest(url string, req Request) (*Response, error) {
 }
 
 // sendStreamRequest sends a streaming HTTP POST request to the given endpoint.
-// It decodes a series of JSON responses and writes each to respChan.
-func sendStreamRequest(url string, req Request, respChan chan<- Response) error {
-	js, err := json.Marshal(req)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-	httpResp, err := http.Post(url, "application/json", bytes.NewReader(js))
+// It decodes a series of JSON responses and writes each to respChan until the
+// stream is done or ctx is cancelled.
+func (o *OllamaAPI) sendStreamRequest(ctx context.Context, url string, req Request, respChan chan<- Response) error {
+	httpResp, err := o.post(ctx, url, req)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return err
 	}
 	defer httpResp.Body.Close()
 
+	if httpResp.StatusCode != http.StatusOK {
+		return statusError(httpResp)
+	}
+
 	decoder := json.NewDecoder(httpResp.Body)
 	for {
 		var resp Response
@@ -97,9 +166,16 @@ func sendStreamRequest(url string, req Request, respChan chan<- Response) error
 			if errors.Is(err, io.EOF) {
 				break
 			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			return fmt.Errorf("failed to decode response: %w", err)
 		}
-		respChan <- resp
+		select {
+		case respChan <- resp:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 		if resp.Done {
 			break
 		}
@@ -108,26 +184,114 @@ func sendStreamRequest(url string, req Request, respChan chan<- Response) error
 	return nil
 }
 
-// runningModelsResponse is used to decode the JSON response from GET /tags.
-type runningModelsResponse struct {
-	Models []struct {
-		Name string `json:"name"`
-	} `json:"models"`
+// post marshals req and POSTs it to url, bound to ctx. It is for requests
+// that change nothing on the server, so they may be retried after a 5xx.
+func (o *OllamaAPI) post(ctx context.Context, url string, req interface{}) (*http.Response, error) {
+	return o.sendJSON(ctx, http.MethodPost, url, req, true)
+}
+
+// sendJSON marshals req and sends it to url with method, bound to ctx. If
+// idempotent is set it may be sent again after a 5xx, see MarkIdempotent.
+func (o *OllamaAPI) sendJSON(ctx context.Context, method, url string, req interface{}, idempotent bool) (*http.Response, error) {
+	js, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(js))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if idempotent {
+		MarkIdempotent(httpReq)
+	}
+
+	httpResp, err := o.client.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	return httpResp, nil
+}
+
+// statusError builds an error from a non-200 response, using the message
+// Ollama puts in the body when there is one.
+func statusError(httpResp *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(httpResp.Body).Decode(&body); err == nil && body.Error != "" {
+		return fmt.Errorf("unexpected response status: %s: %s", httpResp.Status, body.Error)
+	}
+	return fmt.Errorf("unexpected response status: %s", httpResp.Status)
+}
+
+// send delivers ev on results unless ctx is cancelled first.
+func send(ctx context.Context, results chan<- Event, ev Event) bool {
+	select {
+	case results <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
 type OllamaAPI struct {
-	baseURL      string
+	baseURL string
+	client  *http.Client
+
+	// turn guards the conversation. A reply holds it from start to end, so
+	// the history isn't read or changed half way through.
+	turn    sync.Mutex
+	history Tree
+	summary summary // of the messages strategy left out
+
+	// mu guards the settings, which a reply copies as it starts, so they can
+	// be changed while it streams.
+	mu           sync.Mutex
 	model        string
 	systemPrompt string
-	history      []Message
+	options      Options
+	format       json.RawMessage
+	tools        Toolbox
+	strategy     ContextStrategy // how history is fit into the context window
+	embed        EmbedOptions
+	images       []string // attached to the next message
 	closed       bool
 }
 
+// settings are the settings a request is made with.
+type settings struct {
+	model    string
+	options  Options
+	format   json.RawMessage
+	tools    Toolbox
+	strategy ContextStrategy
+}
+
+// settings returns a copy of the current settings. o.mu must be held.
+func (o *OllamaAPI) settings() settings {
+	return settings{model: o.model, options: o.options, format: o.format, tools: o.tools, strategy: o.strategy}
+}
+
+// start copies the settings for a request, taking the attached images. It
+// returns ErrClosed if the API is closed.
+func (o *OllamaAPI) start() (settings, []string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return settings{}, nil, ErrClosed
+	}
+	return o.settings(), o.takeImages(), nil
+}
+
 func NewAPI(baseURL, model, system string) *OllamaAPI {
 	// if we have a system prompt, add it to the start of the history
-	history := make([]Message, 0)
+	history := NewTree(nil)
 	if system != "" {
-		history = append(history, Message{Role: "system", Content: system})
+		history.Append(Message{Role: "system", Content: system})
 	}
 
 	return &OllamaAPI{
@@ -135,15 +299,19 @@ func NewAPI(baseURL, model, system string) *OllamaAPI {
 		systemPrompt: system,
 		history:      history,
 		model:        model,
+		embed:        EmbedOptions{BatchSize: DefaultEmbedBatch, Truncate: true},
+		client:       http.DefaultClient,
 	}
 
 }
 
 func (o *OllamaAPI) Verify() bool {
 	endpoint := o.baseURL + "/version"
-	httpResp, err := http.Get(endpoint)
+	httpResp, err := o.client.Get(endpoint)
 	if err != nil {
+		o.mu.Lock()
 		o.closed = true
+		o.mu.Unlock()
 		return false
 	}
 	defer httpResp.Body.Close()
@@ -152,127 +320,318 @@ func (o *OllamaAPI) Verify() bool {
 
 // Chat sends a chat message using the /chat endpoint.
 // It records the conversation history, sends all messages on each call,
-// and appends the assistant’s reply to the history.
-func (o *OllamaAPI) Chat(message string, results chan string, stream bool) {
-	if o.closed {
-		results <- "Error: API is closed"
+// and appends the assistant’s reply to the history. Generated text arrives as
+// TokenEvents followed by a DoneEvent, or an ErrorEvent if the request fails.
+// If the model calls tools from the toolbox, see SetTools, each call is
+// reported as a ToolCallEvent and its result as a ToolResultEvent, and the
+// results are sent back to the model until it gives a final answer.
+// results is closed when the reply is complete or ctx is cancelled.
+func (o *OllamaAPI) Chat(ctx context.Context, message string, results chan<- Event, stream bool) {
+	defer close(results)
+	o.turn.Lock()
+	defer o.turn.Unlock()
+	s, images, err := o.start()
+	if err == nil && len(images) > 0 {
+		err = o.checkVision(ctx, s.model)
+	}
+	if err != nil {
+		send(ctx, results, Event{Kind: ErrorEvent, Err: err})
 		return
 	}
 	// Append the user's message.
-	o.history = append(o.history, Message{Role: "user", Content: message})
+	o.history.Append(Message{Role: "user", Content: message, Images: images})
+	o.reply(ctx, s, results, stream, true)
+}
+
+// Regenerate asks for a new reply to the last message the user sent. The
+// replies to it so far stay in the history as another branch. Events are
+// delivered to results as by Chat.
+func (o *OllamaAPI) Regenerate(ctx context.Context, results chan<- Event, stream bool) {
+	defer close(results)
+	o.turn.Lock()
+	defer o.turn.Unlock()
+	o.mu.Lock()
+	s, closed := o.settings(), o.closed
+	o.mu.Unlock()
+	if closed {
+		send(ctx, results, Event{Kind: ErrorEvent, Err: ErrClosed})
+		return
+	}
+	if !o.history.RewindReplies() {
+		send(ctx, results, Event{Kind: ErrorEvent, Err: ErrNoMessage})
+		return
+	}
+	o.reply(ctx, s, results, stream, false)
+}
+
+// reply gets the model's answer to the history, calling tools until it
+// gives a final one. If the request fails before anything arrives and pop is
+// set, the user's message is taken back out of the history. A reply stopped
+// by cancelling ctx is kept, as the user saw it. o.turn must be held.
+func (o *OllamaAPI) reply(ctx context.Context, s settings, results chan<- Event, stream, pop bool) {
+	for round := 0; ; round++ {
+		reply, stats, err := o.exchange(ctx, s, results, stream)
+		empty := reply.Content == "" && len(reply.ToolCalls) == 0
+		if err != nil && empty && round == 0 && ctx.Err() == nil {
+			if pop {
+				o.history.Pop()
+			}
+		} else {
+			// Append assistant's reply, even if it was cut short, so the
+			// history keeps alternating between user and assistant.
+			o.history.Append(reply)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				send(ctx, results, Event{Kind: ErrorEvent, Err: err})
+			}
+			return
+		}
+		if len(reply.ToolCalls) == 0 || s.tools == nil {
+			send(ctx, results, Event{Kind: DoneEvent, Stats: stats})
+			return
+		}
+		if round == maxToolRounds {
+			send(ctx, results, Event{Kind: ErrorEvent, Err: fmt.Errorf("gave up after %d rounds of tool calls", round)})
+			return
+		}
+		if !o.callTools(ctx, s.tools, reply.ToolCalls, results) {
+			return
+		}
+	}
+}
+
+// exchange sends the history to the /chat endpoint, delivering generated text
+// to results as TokenEvents, and returns the assistant's reply. When streaming
+// the reply holds whatever arrived before an error. o.turn must be held.
+func (o *OllamaAPI) exchange(ctx context.Context, s settings, results chan<- Event, stream bool) (Message, Stats, error) {
+	reply := Message{Role: "assistant"}
+	messages, dropped, err := o.fitContext(ctx, s)
+	if err != nil {
+		return reply, Stats{}, err
+	}
 	req := Request{
-		Model:    o.model,
-		Messages: o.history,
+		Model:    s.model,
+		Messages: messages,
+		Options:  s.options,
+		Format:   s.format,
 		Stream:   stream,
 	}
+	if s.tools != nil {
+		req.Tools = s.tools.Tools()
+	}
 
 	endpoint := o.baseURL + "/chat"
 
-	if stream {
-		respChan := make(chan Response)
-		go func() {
-			if err := sendStreamRequest(endpoint, req, respChan); err != nil {
-				results <- fmt.Sprintf("Error: %v", err)
-			}
-			close(respChan)
-		}()
+	if !stream {
+		resp, err := o.sendRequest(ctx, endpoint, req)
+		if err != nil {
+			return reply, Stats{}, err
+		}
+		if resp.Message != nil {
+			reply.Content, reply.ToolCalls = resp.Message.Content, resp.Message.ToolCalls
+		}
+		if reply.Content != "" {
+			send(ctx, results, Event{Kind: TokenEvent, Content: reply.Content})
+		}
+		stats := resp.Stats()
+		stats.Dropped = dropped
+		return reply, stats, nil
+	}
 
-		var fullResponse string
-		for resp := range respChan {
-			message := resp.Message.Content
-			results <- message
-			fullResponse += message
-			if resp.Done {
-				break
+	respChan := make(chan Response)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- o.sendStreamRequest(ctx, endpoint, req, respChan)
+		close(respChan)
+	}()
+
+	var stats Stats
+	for resp := range respChan {
+		if resp.Message != nil {
+			if resp.Message.Content != "" {
+				reply.Content += resp.Message.Content
+				send(ctx, results, Event{Kind: TokenEvent, Content: resp.Message.Content})
 			}
+			reply.ToolCalls = append(reply.ToolCalls, resp.Message.ToolCalls...)
 		}
-		close(results)
-		// Append assistant's reply.
-		o.history = append(o.history, Message{Role: "assistant", Content: fullResponse})
-	} else {
-		resp, err := sendRequest(endpoint, req)
-		if err != nil {
-			results <- fmt.Sprintf("Error: %v", err)
-			return
+		if resp.Done {
+			stats = resp.Stats()
 		}
-		results <- resp.Message.Content
-		o.history = append(o.history, Message{Role: "assistant", Content: resp.Response})
 	}
+	stats.Dropped = dropped
+	return reply, stats, <-errc
 }
 
 // Prompt sends a prompt using the /generate endpoint (completion).
-func (o *OllamaAPI) Prompt(message string, results chan string, stream bool) {
-	if o.closed {
-		results <- "Error: API is closed"
+// Events are delivered as for Chat, and results is closed when the response
+// is complete or ctx is cancelled.
+func (o *OllamaAPI) Prompt(ctx context.Context, message string, results chan<- Event, stream bool) {
+	defer close(results)
+	req, err := o.promptRequest(ctx, message, stream)
+	if err != nil {
+		send(ctx, results, Event{Kind: ErrorEvent, Err: err})
 		return
 	}
 
-	req := Request{
-		Model:  o.model,
-		Prompt: message,
-		Stream: stream,
-	}
-
-	if o.systemPrompt != "" {
-		req.System = o.systemPrompt
-	}
-
 	endpoint := o.baseURL + "/generate"
 
 	if stream {
 		respChan := make(chan Response)
+		errc := make(chan error, 1)
 		go func() {
-			if err := sendStreamRequest(endpoint, req, respChan); err != nil {
-				results <- fmt.Sprintf("Error: %v", err)
-			}
+			errc <- o.sendStreamRequest(ctx, endpoint, req, respChan)
 			close(respChan)
 		}()
 		for resp := range respChan {
-			results <- resp.Response
+			if resp.Response != "" {
+				send(ctx, results, Event{Kind: TokenEvent, Content: resp.Response})
+			}
 			if resp.Done {
-				break
+				send(ctx, results, Event{Kind: DoneEvent, Stats: resp.Stats()})
 			}
 		}
-		close(results)
-
+		if err := <-errc; err != nil && ctx.Err() == nil {
+			send(ctx, results, Event{Kind: ErrorEvent, Err: err})
+		}
 	} else {
-		resp, err := sendRequest(endpoint, req)
+		resp, err := o.sendRequest(ctx, endpoint, req)
 		if err != nil {
-			results <- fmt.Sprintf("Error: %v", err)
+			if ctx.Err() == nil {
+				send(ctx, results, Event{Kind: ErrorEvent, Err: err})
+			}
 			return
 		}
-		results <- resp.Response
+		send(ctx, results, Event{Kind: TokenEvent, Content: resp.Response})
+		send(ctx, results, Event{Kind: DoneEvent, Stats: resp.Stats()})
 	}
 }
 
-// Models retrieves the list of local models using the /tags endpoint.
-func (o *OllamaAPI) Models() []string {
-	if o.closed {
-		return []string{}
+// promptRequest builds the /generate request for message from the current
+// settings and attached images.
+func (o *OllamaAPI) promptRequest(ctx context.Context, message string, stream bool) (Request, error) {
+	s, images, err := o.start()
+	if err != nil {
+		return Request{}, err
+	}
+	o.mu.Lock()
+	system := o.systemPrompt
+	o.mu.Unlock()
+	if len(images) > 0 {
+		if err := o.checkVision(ctx, s.model); err != nil {
+			return Request{}, err
+		}
 	}
+	return Request{
+		Model:   s.model,
+		System:  system,
+		Images:  images,
+		Prompt:  message,
+		Options: s.options,
+		Format:  s.format,
+		Stream:  stream,
+	}, nil
+}
 
-	endpoint := o.baseURL + "/tags"
+// Attach adds base64 encoded images, see LoadImage, to the next Chat or
+// Prompt message.
+func (o *OllamaAPI) Attach(images ...string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.images = append(o.images, images...)
+}
 
-	httpResp, err := http.Get(endpoint)
-	if err != nil {
-		//fmt.Printf("Error fetching models: %v\n", err)
+// takeImages returns and clears the attached images. o.mu must be held.
+func (o *OllamaAPI) takeImages() []string {
+	images := o.images
+	o.images = nil
+	return images
+}
+
+// Models retrieves the names of the local models using the /tags endpoint.
+func (o *OllamaAPI) Models() []string {
+	o.mu.Lock()
+	closed := o.closed
+	o.mu.Unlock()
+	if closed {
 		return []string{}
 	}
-	defer httpResp.Body.Close()
 
-	var resp runningModelsResponse
-	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
-		//fmt.Printf("Error decoding models response: %v\n", err)
+	list, err := o.ListModels(context.Background())
+	if err != nil {
 		return []string{}
 	}
 
-	models := make([]string, 0, len(resp.Models))
-	for _, m := range resp.Models {
+	models := make([]string, 0, len(list))
+	for _, m := range list {
 		models = append(models, m.Name)
 	}
 	return models
 }
 
+// SetHTTPClient sets the client requests are sent with, see NewHTTPClient.
+func (o *OllamaAPI) SetHTTPClient(client *http.Client) {
+	o.client = client
+}
+
+// SetOptions sets the generation options sent with every request.
+func (o *OllamaAPI) SetOptions(options Options) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.options = options
+}
+
+// SetFormat constrains replies to JSON, given the JSON string "json", or to a
+// JSON schema. A nil format allows free text.
+func (o *OllamaAPI) SetFormat(format json.RawMessage) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.format = format
+}
+
+// History returns a copy of the current branch of the conversation,
+// including the system prompt.
+func (o *OllamaAPI) History() []Message {
+	o.turn.Lock()
+	defer o.turn.Unlock()
+	return o.history.Branch()
+}
+
+// SetHistory replaces the conversation, e.g. to resume a saved session.
+func (o *OllamaAPI) SetHistory(history []Message) {
+	o.turn.Lock()
+	defer o.turn.Unlock()
+	o.history = NewTree(history)
+	o.summary = summary{}
+}
+
+// Tree returns a copy of the conversation with all its branches.
+func (o *OllamaAPI) Tree() Tree {
+	o.turn.Lock()
+	defer o.turn.Unlock()
+	return o.history.Clone()
+}
+
+// SetTree replaces the conversation and its branches, e.g. to resume a saved
+// session or continue from another branch.
+func (o *OllamaAPI) SetTree(t Tree) {
+	o.turn.Lock()
+	defer o.turn.Unlock()
+	o.history = t.Clone()
+	o.summary = summary{}
+}
+
+// Rewind takes the last user message, and the replies to it, off the current
+// branch and returns it, so it can be edited and sent again as a new branch.
+// It reports false if no message has been sent.
+func (o *OllamaAPI) Rewind() (Message, bool) {
+	o.turn.Lock()
+	defer o.turn.Unlock()
+	return o.history.Rewind()
+}
+
 func (o *OllamaAPI) SelectModel(model string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
 	o.model = model
 }
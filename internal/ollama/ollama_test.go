@@ -0,0 +1,112 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// chat sends message and returns the events delivered for it.
+func chat(o *OllamaAPI, ctx context.Context, message string, stream bool) []Event {
+	results := make(chan Event)
+	go o.Chat(ctx, message, results, stream)
+	var events []Event
+	for ev := range results {
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestChatFailureTakesBackMessage(t *testing.T) {
+	fail := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, `{"error":"model is loading"}`, http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(Response{Message: &Message{Role: "assistant", Content: "a1"}, Done: true})
+	}))
+	defer srv.Close()
+
+	for _, stream := range []bool{false, true} {
+		o := NewAPI(srv.URL, "llama3", "")
+		fail = true
+		events := chat(o, context.Background(), "q1", stream)
+		if len(events) == 0 || events[len(events)-1].Kind != ErrorEvent {
+			t.Fatalf("stream=%v: events = %v, want an error", stream, events)
+		}
+		if h := o.History(); len(h) != 0 {
+			t.Errorf("stream=%v: history after a failed request = %v, want none", stream, h)
+		}
+
+		fail = false
+		chat(o, context.Background(), "q1", stream)
+		var got []string
+		for _, m := range o.History() {
+			got = append(got, m.Role+":"+m.Content)
+		}
+		if want := []string{"user:q1", "assistant:a1"}; !slices.Equal(got, want) {
+			t.Errorf("stream=%v: history = %q, want %q", stream, got, want)
+		}
+	}
+}
+
+func TestChatStoppedKeepsMessage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	o := NewAPI(srv.URL, "llama3", "")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	chat(o, ctx, "q1", true)
+	h := o.History()
+	if len(h) != 2 || h[0].Content != "q1" || h[1].Role != "assistant" {
+		t.Errorf("history after stopping = %v, want q1 and an empty reply", h)
+	}
+}
+
+func TestSettingsChangeDuringStream(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Response{Message: &Message{Role: "assistant", Content: "a"}})
+		w.(http.Flusher).Flush()
+		close(started)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		json.NewEncoder(w).Encode(Response{Message: &Message{Role: "assistant", Content: "1"}, Done: true})
+	}))
+	defer srv.Close()
+
+	o := NewAPI(srv.URL, "llama3", "")
+	results := make(chan Event)
+	go o.Chat(context.Background(), "q1", results, true)
+	<-started
+
+	set := make(chan struct{})
+	go func() {
+		o.SetOptions(Options{"temperature": 0.5})
+		o.SelectModel("mistral")
+		o.SetFormat(json.RawMessage(`"json"`))
+		close(set)
+	}()
+	select {
+	case <-set:
+	case <-time.After(5 * time.Second):
+		t.Fatal("changing settings waited for the stream to finish")
+	}
+	close(release)
+	for range results {
+	}
+	if h := o.History(); len(h) != 2 || h[1].Content != "a1" {
+		t.Errorf("history = %v, want q1 and a1", h)
+	}
+}
@@ -0,0 +1,140 @@
+package ollama
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Options holds model generation parameters sent as the "options" field of a
+// request, e.g. temperature or num_ctx. Unset options use the server defaults.
+type Options map[string]interface{}
+
+type optionKind int
+
+const (
+	floatOption optionKind = iota
+	intOption
+	stringsOption
+)
+
+// optionNames lists the options meh knows how to parse, in display order.
+var optionNames = []string{
+	"temperature",
+	"top_k",
+	"top_p",
+	"num_ctx",
+	"num_predict",
+	"repeat_penalty",
+	"seed",
+	"stop",
+}
+
+var optionKinds = map[string]optionKind{
+	"temperature":    floatOption,
+	"top_k":          intOption,
+	"top_p":          floatOption,
+	"num_ctx":        intOption,
+	"num_predict":    intOption,
+	"repeat_penalty": floatOption,
+	"seed":           intOption,
+	"stop":           stringsOption,
+}
+
+// OptionNames returns the names of the options understood by ParseOption.
+func OptionNames() []string {
+	return append([]string(nil), optionNames...)
+}
+
+// ParseOption converts the string form of a named option to the type Ollama
+// expects. Stop sequences are given as a comma separated list. An empty value
+// parses to nil, meaning the option is unset.
+func ParseOption(name, value string) (interface{}, error) {
+	kind, ok := optionKinds[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown option %q", name)
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	switch kind {
+	case floatOption:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a number", name)
+		}
+		return f, nil
+	case intOption:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a whole number", name)
+		}
+		return i, nil
+	default:
+		var stops []string
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				stops = append(stops, s)
+			}
+		}
+		return stops, nil
+	}
+}
+
+// Merge returns a new Options with the values of other layered over o.
+func (o Options) Merge(other Options) Options {
+	if len(o) == 0 && len(other) == 0 {
+		return nil
+	}
+	merged := make(Options, len(o)+len(other))
+	for k, v := range o {
+		merged[k] = v
+	}
+	for k, v := range other {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Value returns the string form of a named option, as accepted by ParseOption.
+func (o Options) Value(name string) string {
+	v, ok := o[name]
+	if !ok || v == nil {
+		return ""
+	}
+	switch v := v.(type) {
+	case []string:
+		return strings.Join(v, ", ")
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, s := range v {
+			parts[i] = fmt.Sprint(s)
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprint(v)
+}
+
+func (o Options) String() string {
+	keys := make([]string, 0, len(o))
+	for k := range o {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + o.Value(k)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Int returns the value of a named whole number option, or 0 if it is unset.
+func (o Options) Int(name string) int {
+	i, err := strconv.Atoi(o.Value(name))
+	if err != nil {
+		return 0
+	}
+	return i
+}
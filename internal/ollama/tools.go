@@ -0,0 +1,95 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// maxToolRounds bounds how many times a single Chat goes back to the model
+// with tool results before giving up on a final answer.
+const maxToolRounds = 8
+
+// Tool describes a function the model may call, as sent in Request.Tools.
+type Tool struct {
+	Type     string       `json:"type"` // always "function"
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"` // a JSON schema for the arguments
+}
+
+// ToolCall is a request from the model to run a tool.
+type ToolCall struct {
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+func (c ToolCall) String() string {
+	args, _ := json.Marshal(c.Function.Arguments)
+	return fmt.Sprintf("%s(%s)", c.Function.Name, args)
+}
+
+// Toolbox supplies the tools a model may call during Chat.
+type Toolbox interface {
+	Tools() []Tool
+	Call(ctx context.Context, call ToolCall) (string, error)
+	// NeedsApproval reports whether the user must approve a call to the
+	// named tool before it runs, e.g. because it has side effects.
+	NeedsApproval(name string) bool
+}
+
+// SetTools makes the toolbox's tools available to the model in Chat. A nil
+// toolbox disables tool calling.
+func (o *OllamaAPI) SetTools(tools Toolbox) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.tools = tools
+}
+
+// callTools runs each of the model's tool calls and records the results in
+// the history. Calls that need approval wait for a reply on the ToolCallEvent's
+// Approve channel. It returns false if ctx is cancelled. o.turn must be held.
+func (o *OllamaAPI) callTools(ctx context.Context, tools Toolbox, calls []ToolCall, results chan<- Event) bool {
+	for _, call := range calls {
+		var approve chan bool
+		if tools.NeedsApproval(call.Function.Name) {
+			approve = make(chan bool, 1)
+		}
+		if !send(ctx, results, Event{Kind: ToolCallEvent, Call: call, Approve: approve}) {
+			return false
+		}
+		allowed := true
+		if approve != nil {
+			select {
+			case allowed = <-approve:
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		content := "The user declined to run this tool."
+		if allowed {
+			out, err := tools.Call(ctx, call)
+			if err != nil {
+				out = fmt.Sprintf("Error: %v", err)
+			}
+			content = out
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		o.history.Append(Message{Role: "tool", Content: content, ToolName: call.Function.Name})
+		if !send(ctx, results, Event{Kind: ToolResultEvent, Call: call, Content: content}) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,194 @@
+package ollama
+
+// Tree is a conversation that branches wherever a message was edited or a
+// reply regenerated. Each message is a node whose children are the messages
+// that followed it on the different branches; the current branch is the path
+// from a root to Head.
+type Tree struct {
+	Nodes []Node `json:"nodes" yaml:"nodes"`
+	// Head is the index in Nodes of the last message on the current branch,
+	// or -1 if the branch is empty.
+	Head int `json:"head" yaml:"head"`
+}
+
+// Node is a message in a Tree.
+type Node struct {
+	Message `yaml:",inline"`
+	// Parent is the index of the message this one follows, -1 for the first
+	// message of a conversation.
+	Parent int `json:"parent" yaml:"parent"`
+	// Next is the index of the child the branch last continued with, 0 if
+	// none. Children always come after their parent, so 0 is never a child.
+	Next int `json:"next,omitempty" yaml:"next,omitempty"`
+}
+
+// NewTree returns a tree holding messages as its only branch.
+func NewTree(messages []Message) Tree {
+	t := Tree{Head: -1}
+	for _, m := range messages {
+		t.Append(m)
+	}
+	return t
+}
+
+// Clone returns a copy of t that can be changed independently.
+func (t Tree) Clone() Tree {
+	t.Nodes = append([]Node(nil), t.Nodes...)
+	return t
+}
+
+// Branch returns the messages on the current branch, in order.
+func (t Tree) Branch() []Message {
+	path := t.path()
+	messages := make([]Message, len(path))
+	for i, n := range path {
+		messages[i] = t.Nodes[n].Message
+	}
+	return messages
+}
+
+// path returns the indexes of the nodes on the current branch, in order.
+func (t Tree) path() []int {
+	if len(t.Nodes) == 0 {
+		return nil
+	}
+	var path []int
+	for n := t.Head; n >= 0; n = t.Nodes[n].Parent {
+		path = append(path, n)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// Append adds m to the end of the current branch.
+func (t *Tree) Append(m Message) {
+	if len(t.Nodes) == 0 {
+		t.Head = -1
+	}
+	t.Nodes = append(t.Nodes, Node{Message: m, Parent: t.Head})
+	n := len(t.Nodes) - 1
+	if t.Head >= 0 {
+		t.Nodes[t.Head].Next = n
+	}
+	t.Head = n
+}
+
+// Pop removes the last message of the current branch, which must have just
+// been appended, e.g. because sending it failed.
+func (t *Tree) Pop() {
+	n := len(t.Nodes) - 1
+	if n < 0 || t.Head != n {
+		return
+	}
+	parent := t.Nodes[n].Parent
+	t.Nodes = t.Nodes[:n]
+	t.Head = parent
+	if parent >= 0 {
+		t.Nodes[parent].Next = t.lastChild(parent)
+	}
+}
+
+// Truncate moves the head back so the current branch holds its first n
+// messages. The messages after them stay in the tree, and a message appended
+// next starts a new branch.
+func (t *Tree) Truncate(n int) {
+	path := t.path()
+	if n >= len(path) {
+		return
+	}
+	if n <= 0 {
+		t.Head = -1
+		return
+	}
+	t.Head = path[n-1]
+}
+
+// Rewind takes the last user message, and the replies to it, off the current
+// branch and returns it. It reports false if there is none.
+func (t *Tree) Rewind() (Message, bool) {
+	branch := t.Branch()
+	for i := len(branch) - 1; i >= 0; i-- {
+		if branch[i].Role == "user" {
+			t.Truncate(i)
+			return branch[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// RewindReplies takes the replies to the last user message off the current
+// branch, so another can be asked for. It reports false if there is no user
+// message.
+func (t *Tree) RewindReplies() bool {
+	branch := t.Branch()
+	for i := len(branch) - 1; i >= 0; i-- {
+		if branch[i].Role == "user" {
+			t.Truncate(i + 1)
+			return true
+		}
+	}
+	return false
+}
+
+// Siblings returns the position, counting from 1, of the message at index i
+// of the current branch among the alternatives to it, and how many there are.
+func (t Tree) Siblings(i int) (n, count int) {
+	path := t.path()
+	if i < 0 || i >= len(path) {
+		return 0, 0
+	}
+	siblings := t.children(t.Nodes[path[i]].Parent)
+	for j, s := range siblings {
+		if s == path[i] {
+			n = j + 1
+		}
+	}
+	return n, len(siblings)
+}
+
+// Switch replaces the message at index i of the current branch with the
+// alternative delta places after it among its siblings, following the branch
+// that was last taken from there. It reports false if there is no such
+// alternative.
+func (t *Tree) Switch(i, delta int) bool {
+	n, count := t.Siblings(i)
+	if n == 0 || n+delta < 1 || n+delta > count {
+		return false
+	}
+	path := t.path()
+	parent := t.Nodes[path[i]].Parent
+	node := t.children(parent)[n+delta-1]
+	if parent >= 0 {
+		t.Nodes[parent].Next = node
+	}
+	for t.Nodes[node].Next != 0 {
+		node = t.Nodes[node].Next
+	}
+	t.Head = node
+	return true
+}
+
+// children returns the indexes of the messages following the one at index
+// parent, or of the first messages if parent is -1, in the order they were
+// added.
+func (t Tree) children(parent int) []int {
+	var children []int
+	for i, n := range t.Nodes {
+		if n.Parent == parent {
+			children = append(children, i)
+		}
+	}
+	return children
+}
+
+// lastChild returns the index of the latest child of parent, or 0 if it has
+// none.
+func (t Tree) lastChild(parent int) int {
+	children := t.children(parent)
+	if len(children) == 0 {
+		return 0
+	}
+	return children[len(children)-1]
+}
@@ -0,0 +1,151 @@
+package ollama
+
+import (
+	"slices"
+	"testing"
+)
+
+func user(content string) Message      { return Message{Role: "user", Content: content} }
+func assistant(content string) Message { return Message{Role: "assistant", Content: content} }
+
+// contents returns the contents of the messages on the current branch.
+func contents(t Tree) []string {
+	var out []string
+	for _, m := range t.Branch() {
+		out = append(out, m.Content)
+	}
+	return out
+}
+
+func checkBranch(t *testing.T, tree Tree, want ...string) {
+	t.Helper()
+	if got := contents(tree); !slices.Equal(got, want) {
+		t.Errorf("branch = %q, want %q", got, want)
+	}
+}
+
+func checkSiblings(t *testing.T, tree Tree, i, wantN, wantCount int) {
+	t.Helper()
+	if n, count := tree.Siblings(i); n != wantN || count != wantCount {
+		t.Errorf("Siblings(%d) = %d, %d, want %d, %d", i, n, count, wantN, wantCount)
+	}
+}
+
+func TestTreeRegenerate(t *testing.T) {
+	tree := NewTree([]Message{user("q1"), assistant("a1"), user("q2"), assistant("a2")})
+	checkBranch(t, tree, "q1", "a1", "q2", "a2")
+	checkSiblings(t, tree, 3, 1, 1)
+
+	if !tree.RewindReplies() {
+		t.Fatal("RewindReplies() = false")
+	}
+	checkBranch(t, tree, "q1", "a1", "q2")
+	tree.Append(assistant("a2'"))
+	checkBranch(t, tree, "q1", "a1", "q2", "a2'")
+	checkSiblings(t, tree, 3, 2, 2)
+
+	if !tree.Switch(3, -1) {
+		t.Fatal("Switch(3, -1) = false")
+	}
+	checkBranch(t, tree, "q1", "a1", "q2", "a2")
+	checkSiblings(t, tree, 3, 1, 2)
+	if tree.Switch(3, -1) {
+		t.Error("Switch(3, -1) past the first alternative = true")
+	}
+	if !tree.Switch(3, 1) {
+		t.Fatal("Switch(3, 1) = false")
+	}
+	checkBranch(t, tree, "q1", "a1", "q2", "a2'")
+	if tree.Switch(3, 1) {
+		t.Error("Switch(3, 1) past the last alternative = true")
+	}
+}
+
+func TestTreeEdit(t *testing.T) {
+	tree := NewTree([]Message{user("q1"), assistant("a1"), user("q2"), assistant("a2"), user("q3"), assistant("a3")})
+
+	// Editing q2 starts a new branch from a1.
+	m, ok := tree.Rewind()
+	if !ok || m.Content != "q3" {
+		t.Fatalf("Rewind() = %q, %v, want q3, true", m.Content, ok)
+	}
+	if m, _ = tree.Rewind(); m.Content != "q2" {
+		t.Fatalf("Rewind() = %q, want q2", m.Content)
+	}
+	checkBranch(t, tree, "q1", "a1")
+	tree.Append(user("q2'"))
+	tree.Append(assistant("a2'"))
+	checkBranch(t, tree, "q1", "a1", "q2'", "a2'")
+	checkSiblings(t, tree, 2, 2, 2)
+	checkSiblings(t, tree, 3, 1, 1)
+
+	// Switching back to q2 follows its branch to the end.
+	if !tree.Switch(2, -1) {
+		t.Fatal("Switch(2, -1) = false")
+	}
+	checkBranch(t, tree, "q1", "a1", "q2", "a2", "q3", "a3")
+
+	// And switching forward returns to where the edited branch left off.
+	if !tree.Switch(2, 1) {
+		t.Fatal("Switch(2, 1) = false")
+	}
+	checkBranch(t, tree, "q1", "a1", "q2'", "a2'")
+}
+
+func TestTreeEditFirstMessage(t *testing.T) {
+	tree := NewTree([]Message{user("q1"), assistant("a1")})
+	tree.Truncate(0)
+	checkBranch(t, tree)
+	tree.Append(user("q1'"))
+	checkBranch(t, tree, "q1'")
+	checkSiblings(t, tree, 0, 2, 2)
+	if !tree.Switch(0, -1) {
+		t.Fatal("Switch(0, -1) = false")
+	}
+	checkBranch(t, tree, "q1", "a1")
+}
+
+func TestTreePop(t *testing.T) {
+	tree := NewTree([]Message{user("q1"), assistant("a1")})
+	tree.RewindReplies()
+	tree.Append(assistant("a1'"))
+	tree.Pop()
+	checkBranch(t, tree, "q1")
+	checkSiblings(t, tree, 0, 1, 1)
+	if len(tree.Nodes) != 2 {
+		t.Errorf("len(Nodes) = %d after Pop, want 2", len(tree.Nodes))
+	}
+	// The remaining reply is the one the branch continues with again.
+	if !tree.Switch(0, 0) {
+		t.Fatal("Switch(0, 0) = false")
+	}
+	checkBranch(t, tree, "q1", "a1")
+
+	// Pop only removes a message that was just appended.
+	tree.Truncate(1)
+	tree.Pop()
+	if len(tree.Nodes) != 2 {
+		t.Errorf("len(Nodes) = %d after Pop off the end, want 2", len(tree.Nodes))
+	}
+}
+
+func TestTreeRewindEmpty(t *testing.T) {
+	tree := NewTree(nil)
+	if _, ok := tree.Rewind(); ok {
+		t.Error("Rewind() on an empty tree = true")
+	}
+	if tree.RewindReplies() {
+		t.Error("RewindReplies() on an empty tree = true")
+	}
+	checkSiblings(t, tree, 0, 0, 0)
+}
+
+func TestTreeClone(t *testing.T) {
+	tree := NewTree([]Message{user("q1"), assistant("a1")})
+	clone := tree.Clone()
+	clone.RewindReplies()
+	clone.Append(assistant("a1'"))
+	checkBranch(t, tree, "q1", "a1")
+	checkSiblings(t, tree, 1, 1, 1)
+	checkBranch(t, clone, "q1", "a1'")
+}
@@ -0,0 +1,573 @@
+// Package openai talks to servers implementing the OpenAI-compatible
+// /v1/chat/completions API, such as llama.cpp server, vLLM and LM Studio.
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cpcf/meh/internal/ollama"
+)
+
+// Request is the body of a POST to /chat/completions.
+type Request struct {
+	Model          string          `json:"model"`
+	Messages       []Message       `json:"messages"`
+	Stream         bool            `json:"stream"`
+	StreamOptions  *StreamOptions  `json:"stream_options,omitempty"`
+	Temperature    *float64        `json:"temperature,omitempty"`
+	TopP           *float64        `json:"top_p,omitempty"`
+	TopK           *int            `json:"top_k,omitempty"`
+	MaxTokens      *int            `json:"max_tokens,omitempty"`
+	Seed           *int            `json:"seed,omitempty"`
+	Stop           []string        `json:"stop,omitempty"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+// ResponseFormat constrains a reply to JSON, optionally matching a schema.
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+type JSONSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+}
+
+// Message is a chat message as sent to the server. Content is a string, or a
+// list of ContentParts when the message carries images.
+type Message struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+// ContentPart is one piece of a multimodal message.
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+// toMessages converts messages to the OpenAI format, sending any base64
+// images as data URLs.
+func toMessages(messages []ollama.Message) []Message {
+	converted := make([]Message, len(messages))
+	for i, m := range messages {
+		if len(m.Images) == 0 {
+			converted[i] = Message{Role: m.Role, Content: m.Content}
+			continue
+		}
+		parts := []ContentPart{{Type: "text", Text: m.Content}}
+		for _, img := range m.Images {
+			mime := "image/png"
+			if data, err := base64.StdEncoding.DecodeString(img); err == nil {
+				mime = http.DetectContentType(data)
+			}
+			parts = append(parts, ContentPart{
+				Type:     "image_url",
+				ImageURL: &ImageURL{URL: "data:" + mime + ";base64," + img},
+			})
+		}
+		converted[i] = Message{Role: m.Role, Content: parts}
+	}
+	return converted
+}
+
+// StreamOptions asks the server to report token usage in the final chunk.
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// Response is a completion, or a single chunk of one when streaming.
+type Response struct {
+	Choices []struct {
+		Message      *ollama.Message `json:"message,omitempty"`
+		Delta        *ollama.Message `json:"delta,omitempty"`
+		FinishReason string          `json:"finish_reason,omitempty"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// Usage holds the token counts reported for a completion.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// content returns the text carried by the first choice, if any.
+func (r Response) content() string {
+	if len(r.Choices) == 0 {
+		return ""
+	}
+	if c := r.Choices[0]; c.Delta != nil {
+		return c.Delta.Content
+	} else if c.Message != nil {
+		return c.Message.Content
+	}
+	return ""
+}
+
+type modelsResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+type OpenAIAPI struct {
+	baseURL string
+	client  *http.Client
+
+	// turn guards the conversation and is held for the length of a reply.
+	turn    sync.Mutex
+	history ollama.Tree
+
+	// mu guards the settings, which are only read as a request is built, so
+	// they can be changed while a reply streams.
+	mu           sync.Mutex
+	model        string
+	systemPrompt string
+	options      ollama.Options
+	format       json.RawMessage
+	images       []string // attached to the next message
+	closed       bool
+}
+
+// NewAPI returns a client for the server at baseURL, which should include the
+// version prefix, e.g. http://localhost:8080/v1.
+func NewAPI(baseURL, model, system string) *OpenAIAPI {
+	history := ollama.NewTree(nil)
+	if system != "" {
+		history.Append(ollama.Message{Role: "system", Content: system})
+	}
+
+	return &OpenAIAPI{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		systemPrompt: system,
+		history:      history,
+		model:        model,
+		client:       http.DefaultClient,
+	}
+}
+
+func (o *OpenAIAPI) Verify() bool {
+	httpResp, err := o.client.Get(o.baseURL + "/models")
+	if err != nil {
+		o.mu.Lock()
+		o.closed = true
+		o.mu.Unlock()
+		return false
+	}
+	defer httpResp.Body.Close()
+	return httpResp.StatusCode == http.StatusOK
+}
+
+// SetHTTPClient sets the client requests are sent with, see
+// ollama.NewHTTPClient.
+func (o *OpenAIAPI) SetHTTPClient(client *http.Client) {
+	o.client = client
+}
+
+// SetOptions sets the generation options sent with every request. Options
+// without an OpenAI equivalent, such as num_ctx, are ignored.
+func (o *OpenAIAPI) SetOptions(options ollama.Options) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.options = options
+}
+
+// History returns a copy of the current branch of the conversation,
+// including the system prompt.
+func (o *OpenAIAPI) History() []ollama.Message {
+	o.turn.Lock()
+	defer o.turn.Unlock()
+	return o.history.Branch()
+}
+
+// SetHistory replaces the conversation, e.g. to resume a saved session.
+func (o *OpenAIAPI) SetHistory(history []ollama.Message) {
+	o.turn.Lock()
+	defer o.turn.Unlock()
+	o.history = ollama.NewTree(history)
+}
+
+// Tree returns a copy of the conversation with all its branches.
+func (o *OpenAIAPI) Tree() ollama.Tree {
+	o.turn.Lock()
+	defer o.turn.Unlock()
+	return o.history.Clone()
+}
+
+// SetTree replaces the conversation and its branches.
+func (o *OpenAIAPI) SetTree(t ollama.Tree) {
+	o.turn.Lock()
+	defer o.turn.Unlock()
+	o.history = t.Clone()
+}
+
+// Rewind takes the last user message, and the replies to it, off the current
+// branch and returns it, so it can be edited and sent again as a new branch.
+// It reports false if no message has been sent.
+func (o *OpenAIAPI) Rewind() (ollama.Message, bool) {
+	o.turn.Lock()
+	defer o.turn.Unlock()
+	return o.history.Rewind()
+}
+
+// SetFormat constrains replies to JSON, given the JSON string "json", or to a
+// JSON schema. A nil format allows free text.
+func (o *OpenAIAPI) SetFormat(format json.RawMessage) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.format = format
+}
+
+func (o *OpenAIAPI) SelectModel(model string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.model = model
+}
+
+// Chat sends the conversation history with message appended to
+// /chat/completions and records the assistant's reply. Events are delivered
+// as for ollama.OllamaAPI.Chat.
+func (o *OpenAIAPI) Chat(ctx context.Context, message string, results chan<- ollama.Event, stream bool) {
+	defer close(results)
+	o.turn.Lock()
+	defer o.turn.Unlock()
+	o.mu.Lock()
+	closed, images := o.closed, o.takeImages()
+	o.mu.Unlock()
+	if closed {
+		send(ctx, results, ollama.Event{Kind: ollama.ErrorEvent, Err: ollama.ErrClosed})
+		return
+	}
+
+	o.history.Append(ollama.Message{Role: "user", Content: message, Images: images})
+	o.reply(ctx, results, stream, true)
+}
+
+// Regenerate asks for a new reply to the last message the user sent, keeping
+// the replies to it so far as another branch.
+func (o *OpenAIAPI) Regenerate(ctx context.Context, results chan<- ollama.Event, stream bool) {
+	defer close(results)
+	o.turn.Lock()
+	defer o.turn.Unlock()
+	o.mu.Lock()
+	closed := o.closed
+	o.mu.Unlock()
+	if closed {
+		send(ctx, results, ollama.Event{Kind: ollama.ErrorEvent, Err: ollama.ErrClosed})
+		return
+	}
+	if !o.history.RewindReplies() {
+		send(ctx, results, ollama.Event{Kind: ollama.ErrorEvent, Err: ollama.ErrNoMessage})
+		return
+	}
+	o.reply(ctx, results, stream, false)
+}
+
+// reply completes the history and records the assistant's reply. If the
+// request fails before anything arrives and pop is set, the user's message is
+// taken back out of the history. A reply stopped by cancelling ctx is kept,
+// as the user saw it. o.turn must be held.
+func (o *OpenAIAPI) reply(ctx context.Context, results chan<- ollama.Event, stream, pop bool) {
+	o.mu.Lock()
+	req := o.request(o.history.Branch(), stream)
+	o.mu.Unlock()
+	reply, err := o.complete(ctx, req, results, stream)
+	if err != nil && reply == "" && ctx.Err() == nil {
+		if pop {
+			o.history.Pop()
+		}
+	} else {
+		o.history.Append(ollama.Message{Role: "assistant", Content: reply})
+	}
+	if err != nil && ctx.Err() == nil {
+		send(ctx, results, ollama.Event{Kind: ollama.ErrorEvent, Err: err})
+	}
+}
+
+// Prompt sends a single message, with the system prompt but no history.
+func (o *OpenAIAPI) Prompt(ctx context.Context, message string, results chan<- ollama.Event, stream bool) {
+	defer close(results)
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		send(ctx, results, ollama.Event{Kind: ollama.ErrorEvent, Err: ollama.ErrClosed})
+		return
+	}
+	var messages []ollama.Message
+	if o.systemPrompt != "" {
+		messages = append(messages, ollama.Message{Role: "system", Content: o.systemPrompt})
+	}
+	messages = append(messages, ollama.Message{Role: "user", Content: message, Images: o.takeImages()})
+	req := o.request(messages, stream)
+	o.mu.Unlock()
+
+	if _, err := o.complete(ctx, req, results, stream); err != nil && ctx.Err() == nil {
+		send(ctx, results, ollama.Event{Kind: ollama.ErrorEvent, Err: err})
+	}
+}
+
+// Attach adds base64 encoded images, see ollama.LoadImage, to the next Chat
+// or Prompt message.
+func (o *OpenAIAPI) Attach(images ...string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.images = append(o.images, images...)
+}
+
+// takeImages returns and clears the attached images. o.mu must be held.
+func (o *OpenAIAPI) takeImages() []string {
+	images := o.images
+	o.images = nil
+	return images
+}
+
+// Models retrieves the models served using the /models endpoint.
+func (o *OpenAIAPI) Models() []string {
+	o.mu.Lock()
+	closed := o.closed
+	o.mu.Unlock()
+	if closed {
+		return []string{}
+	}
+
+	httpResp, err := o.client.Get(o.baseURL + "/models")
+	if err != nil {
+		return []string{}
+	}
+	defer httpResp.Body.Close()
+
+	var resp modelsResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return []string{}
+	}
+
+	models := make([]string, 0, len(resp.Data))
+	for _, m := range resp.Data {
+		models = append(models, m.ID)
+	}
+	return models
+}
+
+// complete posts req to /chat/completions, sending token and done events to
+// results, and returns the full reply.
+func (o *OpenAIAPI) complete(ctx context.Context, req Request, results chan<- ollama.Event, stream bool) (string, error) {
+	start := time.Now()
+	httpResp, err := o.post(ctx, o.baseURL+"/chat/completions", req)
+	if err != nil {
+		return "", err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return "", statusError(httpResp)
+	}
+
+	if !stream {
+		var resp Response
+		if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+			return "", fmt.Errorf("failed to decode response: %w", err)
+		}
+		reply := resp.content()
+		send(ctx, results, ollama.Event{Kind: ollama.TokenEvent, Content: reply})
+		send(ctx, results, ollama.Event{Kind: ollama.DoneEvent, Stats: stats(resp.Usage, start, start)})
+		return reply, nil
+	}
+
+	// Server-sent events: each "data:" line holds a JSON chunk until [DONE].
+	var (
+		reply      strings.Builder
+		usage      *Usage
+		firstToken time.Time
+	)
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk Response
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return reply.String(), fmt.Errorf("failed to decode response: %w", err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		if content := chunk.content(); content != "" {
+			if firstToken.IsZero() {
+				firstToken = time.Now()
+			}
+			reply.WriteString(content)
+			if !send(ctx, results, ollama.Event{Kind: ollama.TokenEvent, Content: content}) {
+				return reply.String(), ctx.Err()
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return reply.String(), ctx.Err()
+		}
+		return reply.String(), fmt.Errorf("failed to read response: %w", err)
+	}
+	if firstToken.IsZero() {
+		firstToken = time.Now()
+	}
+	send(ctx, results, ollama.Event{Kind: ollama.DoneEvent, Stats: stats(usage, start, firstToken)})
+	return reply.String(), nil
+}
+
+// request builds a chat completion request, mapping the persona's options to
+// their OpenAI equivalents. o.mu must be held.
+func (o *OpenAIAPI) request(messages []ollama.Message, stream bool) Request {
+	req := Request{
+		Model:    o.model,
+		Messages: toMessages(messages),
+		Stream:   stream,
+	}
+	if stream {
+		req.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+	if v, ok := number(o.options["temperature"]); ok {
+		req.Temperature = &v
+	}
+	if v, ok := number(o.options["top_p"]); ok {
+		req.TopP = &v
+	}
+	if v, ok := number(o.options["top_k"]); ok {
+		n := int(v)
+		req.TopK = &n
+	}
+	if v, ok := number(o.options["num_predict"]); ok {
+		n := int(v)
+		req.MaxTokens = &n
+	}
+	if v, ok := number(o.options["seed"]); ok {
+		n := int(v)
+		req.Seed = &n
+	}
+	switch {
+	case len(o.format) == 0:
+	case string(o.format) == `"json"`:
+		req.ResponseFormat = &ResponseFormat{Type: "json_object"}
+	default:
+		req.ResponseFormat = &ResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &JSONSchema{Name: "response", Schema: o.format},
+		}
+	}
+	switch stop := o.options["stop"].(type) {
+	case []string:
+		req.Stop = stop
+	case []interface{}:
+		for _, s := range stop {
+			req.Stop = append(req.Stop, fmt.Sprint(s))
+		}
+	}
+	return req
+}
+
+// number reads a numeric option, which may have been parsed from YAML as
+// either an int or a float.
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// stats converts reported usage and measured timings to ollama.Stats. The
+// server does not report timings, so the prompt is taken to have been
+// evaluated by the time the first token arrived.
+func stats(usage *Usage, start, firstToken time.Time) ollama.Stats {
+	now := time.Now()
+	s := ollama.Stats{
+		PromptEvalDuration: firstToken.Sub(start),
+		EvalDuration:       now.Sub(firstToken),
+		TotalDuration:      now.Sub(start),
+	}
+	if usage != nil {
+		s.PromptEvalCount = usage.PromptTokens
+		s.EvalCount = usage.CompletionTokens
+	}
+	return s
+}
+
+// post marshals req and POSTs it to url, bound to ctx.
+func (o *OpenAIAPI) post(ctx context.Context, url string, req Request) (*http.Response, error) {
+	js, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(js))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	// Completions change nothing on the server, so may be retried after a 5xx.
+	ollama.MarkIdempotent(httpReq)
+
+	httpResp, err := o.client.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	return httpResp, nil
+}
+
+// statusError builds an error from a non-200 response, using the message in
+// the body when there is one.
+func statusError(httpResp *http.Response) error {
+	var body struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.NewDecoder(httpResp.Body).Decode(&body); err == nil && len(body.Error) > 0 {
+		// Servers disagree on whether error is an object or a plain string.
+		var detail struct {
+			Message string `json:"message"`
+		}
+		var msg string
+		if json.Unmarshal(body.Error, &detail) == nil && detail.Message != "" {
+			msg = detail.Message
+		} else if json.Unmarshal(body.Error, &msg) != nil {
+			msg = string(body.Error)
+		}
+		return fmt.Errorf("unexpected response status: %s: %s", httpResp.Status, msg)
+	}
+	return fmt.Errorf("unexpected response status: %s", httpResp.Status)
+}
+
+// send delivers ev on results unless ctx is cancelled first.
+func send(ctx context.Context, results chan<- ollama.Event, ev ollama.Event) bool {
+	select {
+	case results <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
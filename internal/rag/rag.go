@@ -0,0 +1,214 @@
+// Package rag keeps a searchable index of the chunks of a directory's files,
+// each stored with its embedding, so the passages most relevant to a question
+// can be found and added to the prompt.
+package rag
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ChunkSize is about how many bytes of a file go in each chunk.
+const ChunkSize = 1500
+
+// overlapLines is how many lines at the end of a chunk cut off mid-passage
+// are repeated at the start of the next, so the passage can still be found.
+const overlapLines = 2
+
+// Chunk is a passage of a file, from line Start to line End inclusive,
+// counting from 1.
+type Chunk struct {
+	Path   string // relative to the index's root
+	Start  int
+	End    int
+	Text   string
+	Vector []float32 // the embedding of Text, of unit length
+}
+
+// Source cites where the chunk comes from, e.g. cmd/main.go:10-42.
+func (c Chunk) Source() string {
+	if c.Start == c.End {
+		return fmt.Sprintf("%s:%d", c.Path, c.Start)
+	}
+	return fmt.Sprintf("%s:%d-%d", c.Path, c.Start, c.End)
+}
+
+// Index is the chunks of the files under Root, embedded with Model.
+type Index struct {
+	Name    string
+	Root    string
+	Model   string
+	Created time.Time
+	Chunks  []Chunk
+}
+
+// Result is a chunk found by Search, with its similarity to the query
+// between -1 and 1.
+type Result struct {
+	Chunk
+	Score float32
+}
+
+// Split cuts text, the contents of the file at path, into chunks of about
+// ChunkSize bytes made of whole lines. A chunk ends early at a blank line
+// when one falls in its second half, and Markdown files are also split at
+// headings, so chunks tend to hold whole paragraphs, functions and sections.
+func Split(path, text string) []Chunk {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	var heading []bool
+	if strings.EqualFold(filepath.Ext(path), ".md") {
+		heading = headings(lines)
+	}
+	var chunks []Chunk
+	start := 0
+	for start < len(lines) {
+		end, size, brk := start, 0, -1
+		for end < len(lines) {
+			if end > start && heading != nil && heading[end] && size >= ChunkSize/4 {
+				brk = end
+				break
+			}
+			if size += len(lines[end]) + 1; size > ChunkSize && end > start {
+				break
+			}
+			if strings.TrimSpace(lines[end]) == "" && size >= ChunkSize/2 {
+				brk = end + 1
+			}
+			end++
+		}
+		natural := end < len(lines) && brk > start
+		if natural {
+			end = brk
+		}
+		if body := strings.Join(lines[start:end], "\n"); strings.TrimSpace(body) != "" {
+			chunks = append(chunks, Chunk{Path: filepath.ToSlash(path), Start: start + 1, End: end, Text: body})
+		}
+		if end == len(lines) {
+			break
+		}
+		if natural {
+			start = end
+		} else {
+			start = max(end-overlapLines, start+1)
+		}
+	}
+	return chunks
+}
+
+// headings marks the Markdown headings among lines, leaving out the lines of
+// fenced code blocks, where # starts a comment.
+func headings(lines []string) []bool {
+	marks := make([]bool, len(lines))
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if fence != "" {
+			// A fence is closed by a run of its character at least as long.
+			if strings.HasPrefix(trimmed, fence) && strings.TrimRight(trimmed, fence[:1]+" \t") == "" {
+				fence = ""
+			}
+			continue
+		}
+		if n := len(trimmed) - len(strings.TrimLeft(trimmed, "`")); n >= 3 {
+			fence = trimmed[:n]
+		} else if n := len(trimmed) - len(strings.TrimLeft(trimmed, "~")); n >= 3 {
+			fence = trimmed[:n]
+		} else {
+			marks[i] = strings.HasPrefix(line, "#")
+		}
+	}
+	return marks
+}
+
+// Normalize scales v to unit length in place, so the similarity of two
+// vectors is their dot product.
+func Normalize(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+}
+
+// Similarity returns the cosine similarity of a and b, between -1 and 1, or
+// 0 if they differ in length or either is all zeros.
+func Similarity(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32(dot / math.Sqrt(na*nb))
+}
+
+// Search returns the k chunks most similar to the embedding query, most
+// similar first.
+func (idx *Index) Search(query []float32, k int) []Result {
+	q := append([]float32(nil), query...)
+	Normalize(q)
+	results := make([]Result, 0, len(idx.Chunks))
+	for _, c := range idx.Chunks {
+		if len(c.Vector) != len(q) {
+			continue
+		}
+		var score float32
+		for i, x := range c.Vector {
+			score += x * q[i]
+		}
+		results = append(results, Result{Chunk: c, Score: score})
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// Save writes the index to the file at path.
+func (idx *Index) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(idx); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return f.Close()
+}
+
+// Load reads the index saved in the file at path.
+func Load(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var idx Index
+	if err := gob.NewDecoder(f).Decode(&idx); err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+	return &idx, nil
+}
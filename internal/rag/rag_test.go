@@ -0,0 +1,170 @@
+package rag
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lines returns n numbered lines of about width bytes each.
+func lines(prefix string, n, width int) []string {
+	out := make([]string, n)
+	for i := range out {
+		line := fmt.Sprintf("%s %d ", prefix, i+1)
+		out[i] = line + strings.Repeat("x", max(width-len(line), 0))
+	}
+	return out
+}
+
+// starts returns the first line of each chunk.
+func starts(chunks []Chunk) []string {
+	var out []string
+	for _, c := range chunks {
+		first, _, _ := strings.Cut(c.Text, "\n")
+		out = append(out, first)
+	}
+	return out
+}
+
+func TestSplitSizes(t *testing.T) {
+	text := strings.Join(lines("line", 200, 60), "\n") + "\n"
+	all := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	chunks := Split("notes.txt", text)
+	if len(chunks) < 2 {
+		t.Fatalf("Split() = %d chunks, want several", len(chunks))
+	}
+	for i, c := range chunks {
+		if len(c.Text) > ChunkSize {
+			t.Errorf("chunk %d is %d bytes, want at most %d", i, len(c.Text), ChunkSize)
+		}
+		if want := strings.Join(all[c.Start-1:c.End], "\n"); c.Text != want {
+			t.Errorf("chunk %d text doesn't match lines %d-%d", i, c.Start, c.End)
+		}
+		if i > 0 {
+			// Chunks cut off mid-passage overlap.
+			if prev := chunks[i-1]; c.Start != prev.End-overlapLines+1 {
+				t.Errorf("chunk %d starts at line %d after one ending at %d, want %d lines of overlap", i, c.Start, prev.End, overlapLines)
+			}
+		}
+	}
+	if first, last := chunks[0], chunks[len(chunks)-1]; first.Start != 1 || last.End != len(all) {
+		t.Errorf("chunks cover lines %d-%d, want 1-%d", first.Start, last.End, len(all))
+	}
+
+	// A single long line is kept whole.
+	long := strings.Repeat("y", 2*ChunkSize)
+	if chunks := Split("a.txt", long); len(chunks) != 1 || chunks[0].Text != long {
+		t.Errorf("Split() of one long line = %d chunks, want it whole", len(chunks))
+	}
+	if chunks := Split("a.txt", "\n\n  \n"); len(chunks) != 0 {
+		t.Errorf("Split() of blank lines = %v, want none", chunks)
+	}
+}
+
+func TestSplitBlankLines(t *testing.T) {
+	// Two paragraphs, together too big for a chunk.
+	para := lines("para", 15, 60)
+	text := strings.Join(append(append(para[:len(para):len(para)], ""), lines("next", 15, 60)...), "\n")
+	chunks := Split("notes.txt", text)
+	if got := starts(chunks); len(got) < 2 || !strings.HasPrefix(got[1], "next 1 ") {
+		t.Errorf("chunks start with %q, want a break at the blank line", got)
+	}
+}
+
+func TestSplitMarkdownHeadings(t *testing.T) {
+	section := func(title string) []string {
+		return append([]string{"# " + title}, lines(title, 8, 60)...)
+	}
+	var doc []string
+	for _, title := range []string{"Install", "Usage", "License"} {
+		doc = append(doc, section(title)...)
+	}
+	text := strings.Join(doc, "\n")
+
+	want := []string{"# Install", "# Usage", "# License"}
+	if got := starts(Split("README.md", text)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Markdown chunks start with %q, want %q", got, want)
+	}
+	// Other files aren't split at # lines.
+	if got := starts(Split("script.sh", text)); reflect.DeepEqual(got, want) {
+		t.Errorf("shell chunks start with %q, want no breaks at # lines", got)
+	}
+}
+
+func TestSplitMarkdownFences(t *testing.T) {
+	var doc []string
+	doc = append(doc, "# Setup")
+	doc = append(doc, lines("intro", 8, 60)...)
+	for _, fence := range []string{"```sh", "~~~~"} {
+		doc = append(doc, fence, "# install the tools", "make tools", "# then build", "make")
+		if fence == "~~~~" {
+			doc = append(doc, "~~~ not the end", "# still code")
+		}
+		doc = append(doc, lines("code", 4, 40)...)
+		doc = append(doc, strings.Trim(fence, "sh"))
+	}
+	doc = append(doc, lines("after", 4, 60)...)
+	doc = append(doc, "# Next")
+	doc = append(doc, lines("next", 4, 60)...)
+
+	chunks := Split("guide.md", strings.Join(doc, "\n"))
+	want := []string{"# Setup", "# Next"}
+	if got := starts(chunks); !reflect.DeepEqual(got, want) {
+		t.Errorf("chunks start with %q, want %q", got, want)
+	}
+}
+
+func TestHeadings(t *testing.T) {
+	doc := []string{
+		"# Title",
+		"```go",
+		"# not a heading",
+		"```",
+		"## Section",
+		"  ````",
+		"```",
+		"# in a longer fence",
+		"````",
+		"#tag",
+	}
+	got := headings(doc)
+	want := []bool{true, false, false, false, true, false, false, false, false, true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("headings() = %v, want %v", got, want)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	idx := &Index{
+		Name:    "docs",
+		Root:    "/src/docs",
+		Model:   "nomic-embed-text",
+		Created: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+		Chunks: []Chunk{
+			{Path: "a.md", Start: 1, End: 4, Text: "# A\nabout a", Vector: []float32{0.6, 0.8}},
+			{Path: "b/c.go", Start: 10, End: 10, Text: "package c", Vector: []float32{1, 0}},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "indexes", "docs.gob")
+	if err := idx.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Created.Equal(idx.Created) {
+		t.Errorf("Created = %v, want %v", got.Created, idx.Created)
+	}
+	got.Created = idx.Created
+	if !reflect.DeepEqual(got, idx) {
+		t.Errorf("Load() = %+v, want %+v", got, idx)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.gob")); err == nil {
+		t.Error("Load() of a missing file succeeded")
+	}
+}
@@ -0,0 +1,374 @@
+// Package schema validates JSON documents against the commonly used subset of
+// JSON Schema: type, enum, const, properties, required, additionalProperties,
+// items, length and range limits, pattern, and the allOf/anyOf/oneOf/not
+// combinators. References ($ref) are not supported.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Validate checks that the JSON document data conforms to schema.
+func Validate(schema, data []byte) error {
+	s, err := decode(schema)
+	if err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	doc, err := decode(data)
+	if err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return validate(s, doc, "$")
+}
+
+// Check returns an error if schema is not a usable JSON schema.
+func Check(schema []byte) error {
+	s, err := decode(schema)
+	if err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	switch s.(type) {
+	case map[string]interface{}, bool:
+		return nil
+	}
+	return errors.New("invalid schema: must be an object")
+}
+
+func decode(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after top-level value")
+	}
+	return v, nil
+}
+
+func validate(schema, v interface{}, path string) error {
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			return fmt.Errorf("%s: not allowed", path)
+		}
+		return nil
+	case map[string]interface{}:
+		for _, err := range []error{
+			checkType(s, v, path),
+			checkEnum(s, v, path),
+			checkObject(s, v, path),
+			checkArray(s, v, path),
+			checkString(s, v, path),
+			checkNumber(s, v, path),
+			checkCombinators(s, v, path),
+		} {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%s: invalid schema", path)
+}
+
+func checkType(s map[string]interface{}, v interface{}, path string) error {
+	var types []string
+	switch t := s["type"].(type) {
+	case string:
+		types = []string{t}
+	case []interface{}:
+		for _, name := range t {
+			if name, ok := name.(string); ok {
+				types = append(types, name)
+			}
+		}
+	default:
+		return nil
+	}
+	for _, t := range types {
+		if hasType(v, t) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(types, " or "), typeOf(v))
+}
+
+func hasType(v interface{}, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	}
+	return typeOf(v) == t
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func checkEnum(s map[string]interface{}, v interface{}, path string) error {
+	if c, ok := s["const"]; ok && !equal(c, v) {
+		return fmt.Errorf("%s: must be %s", path, show(c))
+	}
+	enum, ok := s["enum"].([]interface{})
+	if !ok {
+		return nil
+	}
+	for _, e := range enum {
+		if equal(e, v) {
+			return nil
+		}
+	}
+	options := make([]string, len(enum))
+	for i, e := range enum {
+		options[i] = show(e)
+	}
+	return fmt.Errorf("%s: must be one of %s", path, strings.Join(options, ", "))
+}
+
+func checkObject(s map[string]interface{}, v interface{}, path string) error {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, name := range required {
+			name, _ := name.(string)
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+	}
+	props, _ := s["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if ps, ok := props[k]; ok {
+			if err := validate(ps, obj[k], path+"."+k); err != nil {
+				return err
+			}
+			continue
+		}
+		if additional, ok := s["additionalProperties"]; ok {
+			if err := validate(additional, obj[k], path+"."+k); err != nil {
+				return err
+			}
+		}
+	}
+	if n, ok := limit(s, "minProperties"); ok && float64(len(obj)) < n {
+		return fmt.Errorf("%s: must have at least %v properties", path, n)
+	}
+	if n, ok := limit(s, "maxProperties"); ok && float64(len(obj)) > n {
+		return fmt.Errorf("%s: must have at most %v properties", path, n)
+	}
+	return nil
+}
+
+func checkArray(s map[string]interface{}, v interface{}, path string) error {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	if items, ok := s["items"]; ok {
+		for i, item := range arr {
+			if err := validate(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	if n, ok := limit(s, "minItems"); ok && float64(len(arr)) < n {
+		return fmt.Errorf("%s: must have at least %v items", path, n)
+	}
+	if n, ok := limit(s, "maxItems"); ok && float64(len(arr)) > n {
+		return fmt.Errorf("%s: must have at most %v items", path, n)
+	}
+	if unique, _ := s["uniqueItems"].(bool); unique {
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if equal(arr[i], arr[j]) {
+					return fmt.Errorf("%s: items must be unique", path)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func checkString(s map[string]interface{}, v interface{}, path string) error {
+	str, ok := v.(string)
+	if !ok {
+		return nil
+	}
+	length := float64(len([]rune(str)))
+	if n, ok := limit(s, "minLength"); ok && length < n {
+		return fmt.Errorf("%s: must be at least %v characters", path, n)
+	}
+	if n, ok := limit(s, "maxLength"); ok && length > n {
+		return fmt.Errorf("%s: must be at most %v characters", path, n)
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern in schema: %w", path, err)
+		}
+		if !re.MatchString(str) {
+			return fmt.Errorf("%s: must match %q", path, pattern)
+		}
+	}
+	return nil
+}
+
+func checkNumber(s map[string]interface{}, v interface{}, path string) error {
+	num, ok := v.(json.Number)
+	if !ok {
+		return nil
+	}
+	f, err := num.Float64()
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if n, ok := limit(s, "minimum"); ok && f < n {
+		return fmt.Errorf("%s: must be at least %v", path, n)
+	}
+	if n, ok := limit(s, "maximum"); ok && f > n {
+		return fmt.Errorf("%s: must be at most %v", path, n)
+	}
+	if n, ok := limit(s, "exclusiveMinimum"); ok && f <= n {
+		return fmt.Errorf("%s: must be greater than %v", path, n)
+	}
+	if n, ok := limit(s, "exclusiveMaximum"); ok && f >= n {
+		return fmt.Errorf("%s: must be less than %v", path, n)
+	}
+	return nil
+}
+
+func checkCombinators(s map[string]interface{}, v interface{}, path string) error {
+	if all, ok := s["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			if err := validate(sub, v, path); err != nil {
+				return err
+			}
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]interface{}); ok {
+		var firstErr error
+		for _, sub := range anyOf {
+			err := validate(sub, v, path)
+			if err == nil {
+				firstErr = nil
+				break
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if firstErr != nil {
+			return fmt.Errorf("%s: does not match any allowed schema (%v)", path, firstErr)
+		}
+	}
+	if oneOf, ok := s["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, sub := range oneOf {
+			if validate(sub, v, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s: must match exactly one allowed schema, matched %d", path, matches)
+		}
+	}
+	if not, ok := s["not"]; ok && validate(not, v, path) == nil {
+		return fmt.Errorf("%s: matches a disallowed schema", path)
+	}
+	return nil
+}
+
+// limit reads a numeric keyword from the schema.
+func limit(s map[string]interface{}, key string) (float64, bool) {
+	n, ok := s[key].(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+// equal compares decoded JSON values, treating numbers by value at any
+// depth, so [1] equals [1.0].
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		af, aerr := a.Float64()
+		bf, berr := b.Float64()
+		return aerr == nil && berr == nil && af == bf
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, av := range a {
+			bv, ok := b[k]
+			if !ok || !equal(av, bv) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func show(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,79 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		data   string
+		err    string // a substring of the error, or "" if data is valid
+	}{
+		{"type string", `{"type":"string"}`, `"hi"`, ""},
+		{"type mismatch", `{"type":"string"}`, `1`, "$: expected string, got number"},
+		{"type list", `{"type":["string","null"]}`, `null`, ""},
+		{"integer", `{"type":"integer"}`, `3.0`, ""},
+		{"not integer", `{"type":"integer"}`, `3.5`, "expected integer"},
+		{"required", `{"type":"object","required":["a"]}`, `{"b":1}`, `missing required property "a"`},
+		{"required present", `{"required":["a"]}`, `{"a":null}`, ""},
+		{"enum", `{"enum":["red","green"]}`, `"green"`, ""},
+		{"enum mismatch", `{"enum":["red","green"]}`, `"blue"`, `must be one of "red", "green"`},
+		{"enum number", `{"enum":[1,2]}`, `2.0`, ""},
+		{"const", `{"const":"x"}`, `"x"`, ""},
+		{"const mismatch", `{"const":"x"}`, `"y"`, `must be "x"`},
+		{"minimum", `{"minimum":1}`, `0`, "must be at least 1"},
+		{"maximum", `{"maximum":1}`, `1`, ""},
+		{"exclusiveMaximum", `{"exclusiveMaximum":1}`, `1`, "must be less than 1"},
+		{"minLength", `{"minLength":3}`, `"héé"`, ""},
+		{"maxLength", `{"maxLength":2}`, `"abc"`, "must be at most 2 characters"},
+		{"pattern", `{"pattern":"^[a-z]+$"}`, `"abc"`, ""},
+		{"pattern mismatch", `{"pattern":"^[a-z]+$"}`, `"ab1"`, `must match "^[a-z]+$"`},
+		{"items", `{"items":{"type":"number"}}`, `[1,2]`, ""},
+		{"items mismatch", `{"items":{"type":"number"}}`, `[1,"2"]`, "$[1]: expected number"},
+		{"minItems", `{"minItems":2}`, `[1]`, "must have at least 2 items"},
+		{"properties", `{"properties":{"a":{"type":"string"}}}`, `{"a":1}`, "$.a: expected string"},
+		{"additionalProperties false", `{"properties":{"a":{}},"additionalProperties":false}`, `{"a":1,"b":2}`, "$.b: not allowed"},
+		{"additionalProperties schema", `{"additionalProperties":{"type":"number"}}`, `{"a":1,"b":2}`, ""},
+		{"anyOf", `{"anyOf":[{"type":"string"},{"type":"number"}]}`, `true`, "does not match any allowed schema"},
+		{"oneOf", `{"oneOf":[{"minimum":0},{"maximum":10}]}`, `5`, "must match exactly one"},
+		{"not", `{"not":{"type":"null"}}`, `null`, "matches a disallowed schema"},
+		{"nested const array", `{"const":[1,{"a":2}]}`, `[1.0,{"a":2.0}]`, ""},
+		{"nested const object", `{"const":{"a":1}}`, `{"a":1.0}`, ""},
+		{"nested const mismatch", `{"const":{"a":1}}`, `{"a":1,"b":2}`, `must be {"a":1}`},
+		{"nested enum", `{"enum":[[1],[2]]}`, `[2.0]`, ""},
+		{"uniqueItems", `{"uniqueItems":true}`, `[[1],[1.0]]`, "items must be unique"},
+		{"uniqueItems objects", `{"uniqueItems":true}`, `[{"a":1},{"a":1.0}]`, "items must be unique"},
+		{"uniqueItems distinct", `{"uniqueItems":true}`, `[[1],[1,1],"1"]`, ""},
+		{"false schema", `false`, `1`, "$: not allowed"},
+		{"invalid JSON", `{}`, `{`, "invalid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate([]byte(tt.schema), []byte(tt.data))
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("Validate(%s, %s) = %v, want nil", tt.schema, tt.data, err)
+			case tt.err != "" && err == nil:
+				t.Errorf("Validate(%s, %s) = nil, want error containing %q", tt.schema, tt.data, tt.err)
+			case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+				t.Errorf("Validate(%s, %s) = %v, want error containing %q", tt.schema, tt.data, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, schema := range []string{`{}`, `true`, `{"type":"object"}`} {
+		if err := Check([]byte(schema)); err != nil {
+			t.Errorf("Check(%s) = %v, want nil", schema, err)
+		}
+	}
+	for _, schema := range []string{`[]`, `"string"`, `{`, `{} {}`} {
+		if err := Check([]byte(schema)); err == nil {
+			t.Errorf("Check(%s) = nil, want error", schema)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultCommands are the programs run_command may run when a persona
+// doesn't list its own. None of them changes anything, and the files they
+// are given are held to the working directory.
+var DefaultCommands = []string{"date", "echo", "grep", "head", "ls", "pwd", "tail", "wc"}
+
+// commandTimeout bounds how long run_command and http_get may take.
+const commandTimeout = 30 * time.Second
+
+// Builtin returns a registry of the named built-in tools: read_file,
+// list_directory, run_command and http_get. read_file and list_directory
+// only reach the working directory and below. run_command may only run the
+// programs in commands, or DefaultCommands if there are none, on files in the
+// working directory.
+func Builtin(names, commands []string) (*Registry, error) {
+	if len(commands) == 0 {
+		commands = DefaultCommands
+	}
+	builtins := map[string]Tool{
+		"read_file":      readFile,
+		"list_directory": listDirectory,
+		"run_command":    runCommand(commands),
+		"http_get":       httpGet,
+	}
+	r := NewRegistry()
+	for _, name := range names {
+		t, ok := builtins[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown tool %q", name)
+		}
+		r.Register(t)
+	}
+	return r, nil
+}
+
+var readFile = Tool{
+	Name:        "read_file",
+	Description: "Read the contents of a text file in the working directory.",
+	Parameters: []byte(`{
+		"type": "object",
+		"properties": {"path": {"type": "string", "description": "Path of the file"}},
+		"required": ["path"]
+	}`),
+	Run: func(ctx context.Context, args map[string]interface{}) (string, error) {
+		path, err := stringArg(args, "path")
+		if err != nil {
+			return "", err
+		}
+		path, err = localPath(path)
+		if err != nil {
+			return "", err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		data, err := io.ReadAll(io.LimitReader(f, maxOutput+1))
+		return string(data), err
+	},
+}
+
+var listDirectory = Tool{
+	Name:        "list_directory",
+	Description: "List the entries of a directory in the working directory. Subdirectories end with a slash.",
+	Parameters: []byte(`{
+		"type": "object",
+		"properties": {"path": {"type": "string", "description": "Path of the directory, . for the current one"}},
+		"required": ["path"]
+	}`),
+	Run: func(ctx context.Context, args map[string]interface{}) (string, error) {
+		path, err := stringArg(args, "path")
+		if err != nil {
+			return "", err
+		}
+		path, err = localPath(path)
+		if err != nil {
+			return "", err
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return "", err
+		}
+		var b strings.Builder
+		for _, e := range entries {
+			b.WriteString(e.Name())
+			if e.IsDir() {
+				b.WriteString("/")
+			}
+			b.WriteString("\n")
+		}
+		return b.String(), nil
+	},
+}
+
+// localPath resolves path, following symlinks, and checks that it lies within
+// the working directory.
+func localPath(path string) (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	if wd, err = filepath.EvalSymlinks(wd); err != nil {
+		return "", err
+	}
+	abs := path
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(wd, abs)
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(wd, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the working directory", path)
+	}
+	return resolved, nil
+}
+
+// runCommand returns a tool running one of the allowed programs, without a
+// shell, and reporting its combined output. Arguments naming files must name
+// files in the working directory, see checkPaths.
+func runCommand(allowed []string) Tool {
+	return Tool{
+		Name:        "run_command",
+		Description: "Run a program and return its output. Allowed programs: " + strings.Join(allowed, ", ") + ".",
+		Parameters: []byte(`{
+			"type": "object",
+			"properties": {
+				"command": {"type": "string", "description": "Name of the program"},
+				"args": {"type": "array", "items": {"type": "string"}, "description": "Arguments to the program"}
+			},
+			"required": ["command"]
+		}`),
+		SideEffects: true,
+		Run: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			command, err := stringArg(args, "command")
+			if err != nil {
+				return "", err
+			}
+			if !slices.Contains(allowed, command) {
+				return "", fmt.Errorf("%s is not an allowed command", command)
+			}
+			var argv []string
+			if list, ok := args["args"].([]interface{}); ok {
+				for _, a := range list {
+					argv = append(argv, fmt.Sprint(a))
+				}
+			}
+			if err := checkPaths(argv); err != nil {
+				return "", err
+			}
+			ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+			defer cancel()
+			out, err := exec.CommandContext(ctx, command, argv...).CombinedOutput()
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				// The output explains the failure better than the status alone.
+				return fmt.Sprintf("%s\n[%v]", out, err), nil
+			}
+			return string(out), err
+		},
+	}
+}
+
+// checkPaths returns an error if an argument, or the value of a flag such as
+// --file=x or -fx, looks like a path outside the working directory: it is
+// absolute, climbs out with .., or names a file that resolves outside.
+// Arguments naming nothing, such as grep patterns, are left alone.
+func checkPaths(args []string) error {
+	for _, arg := range args {
+		candidates := []string{arg}
+		if strings.HasPrefix(arg, "-") {
+			candidates = nil
+			if _, value, ok := strings.Cut(arg, "="); ok {
+				candidates = append(candidates, value)
+			}
+			if !strings.HasPrefix(arg, "--") && len(arg) > 2 {
+				candidates = append(candidates, arg[2:])
+			}
+		}
+		for _, path := range candidates {
+			if !looksLikePath(path) {
+				continue
+			}
+			if _, err := localPath(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// looksLikePath reports whether arg is a path that checkPaths must check.
+func looksLikePath(arg string) bool {
+	if arg == "" {
+		return false
+	}
+	if filepath.IsAbs(arg) || slices.Contains(strings.Split(filepath.ToSlash(arg), "/"), "..") {
+		return true
+	}
+	_, err := os.Lstat(arg)
+	return err == nil
+}
+
+var httpGet = Tool{
+	Name:        "http_get",
+	Description: "Fetch a URL on localhost with an HTTP GET request and return the response body.",
+	Parameters: []byte(`{
+		"type": "object",
+		"properties": {"url": {"type": "string", "description": "URL to fetch, on localhost"}},
+		"required": ["url"]
+	}`),
+	Run: func(ctx context.Context, args map[string]interface{}) (string, error) {
+		raw, err := stringArg(args, "url")
+		if err != nil {
+			return "", err
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "", err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return "", fmt.Errorf("unsupported scheme %q", u.Scheme)
+		}
+		if !isLocal(u.Hostname()) {
+			return "", fmt.Errorf("%s is not on localhost", u.Host)
+		}
+		ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := localClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxOutput+1))
+		return fmt.Sprintf("%s\n\n%s", resp.Status, body), err
+	},
+}
+
+// localClient refuses to follow redirects away from localhost.
+var localClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if !isLocal(req.URL.Hostname()) {
+			return fmt.Errorf("redirect to %s is not on localhost", req.URL.Host)
+		}
+		return nil
+	},
+}
+
+// isLocal reports whether host names the local machine.
+func isLocal(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,139 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cpcf/meh/internal/ollama"
+)
+
+// chdir makes a new directory, holding a file and a directory, the working
+// directory for the rest of the test and returns it. outside is a directory
+// next to it holding a secret file.
+func chdir(t *testing.T) (dir, outside string) {
+	t.Helper()
+	root := t.TempDir()
+	dir, outside = filepath.Join(root, "work"), filepath.Join(root, "outside")
+	for _, d := range []string{filepath.Join(dir, "sub"), outside} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, content := range map[string]string{
+		filepath.Join(dir, "notes.txt"):      "meh\n",
+		filepath.Join(outside, "secret.txt"): "hunter2\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir, outside
+}
+
+func TestLocalPath(t *testing.T) {
+	dir, outside := chdir(t)
+	if err := os.Symlink(outside, filepath.Join(dir, "escape")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	if err := os.Symlink("notes.txt", filepath.Join(dir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"notes.txt", true},
+		{".", true},
+		{"sub/../notes.txt", true},
+		{filepath.Join(dir, "notes.txt"), true},
+		{"link.txt", true}, // a symlink staying inside
+		{"../outside/secret.txt", false},
+		{"sub/../../outside/secret.txt", false},
+		{"..", false},
+		{filepath.Join(outside, "secret.txt"), false},
+		{"escape/secret.txt", false}, // a symlink leading out
+		{"escape", false},
+		{"missing.txt", false},
+	}
+	for _, tt := range tests {
+		if _, err := localPath(tt.path); (err == nil) != tt.ok {
+			t.Errorf("localPath(%q) = %v, want ok %v", tt.path, err, tt.ok)
+		}
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	_, outside := chdir(t)
+	r, err := Builtin([]string{"run_command"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(command string, args ...string) (string, error) {
+		list := make([]interface{}, len(args))
+		for i, a := range args {
+			list[i] = a
+		}
+		return r.Call(context.Background(), ollama.ToolCall{Function: ollama.ToolCallFunction{
+			Name:      "run_command",
+			Arguments: map[string]interface{}{"command": command, "args": list},
+		}})
+	}
+
+	tests := []struct {
+		command string
+		args    []string
+		ok      bool
+	}{
+		{"head", []string{"-n", "1", "notes.txt"}, true},
+		{"grep", []string{"-r", "meh", "."}, true},
+		{"grep", []string{"../x"}, false}, // a pattern shaped like a path is refused too
+		{"head", []string{"../outside/secret.txt"}, false},
+		{"head", []string{filepath.Join(outside, "secret.txt")}, false},
+		{"grep", []string{"--file=" + filepath.Join(outside, "secret.txt"), "notes.txt"}, false},
+		{"grep", []string{"-f" + filepath.Join(outside, "secret.txt"), "notes.txt"}, false},
+		{"git", []string{"status"}, false}, // not allowed by default
+		{"rm", []string{"notes.txt"}, false},
+		{"sh", []string{"-c", "cat /etc/passwd"}, false},
+	}
+	for _, tt := range tests {
+		out, err := run(tt.command, tt.args...)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s %q = %q, %v, want ok %v", tt.command, tt.args, out, err, tt.ok)
+		}
+		if strings.Contains(out, "hunter2") {
+			t.Errorf("%s %q read a file outside the working directory", tt.command, tt.args)
+		}
+	}
+	if _, err := os.Stat("notes.txt"); err != nil {
+		t.Error("a command that isn't allowed ran:", err)
+	}
+}
+
+func TestBuiltinCommands(t *testing.T) {
+	r, err := Builtin([]string{"run_command"}, []string{"git"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := r.tools["run_command"].Description
+	if !strings.HasSuffix(desc, "Allowed programs: git.") {
+		t.Errorf("description = %q, want only the persona's commands", desc)
+	}
+	if !r.NeedsApproval("run_command") {
+		t.Error("run_command doesn't need approval")
+	}
+	if _, err := Builtin([]string{"rm_rf"}, nil); err == nil {
+		t.Error("Builtin() accepted an unknown tool")
+	}
+}
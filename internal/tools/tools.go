@@ -0,0 +1,99 @@
+// Package tools provides functions that models may call during a chat, and a
+// registry that offers them to the API.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/cpcf/meh/internal/ollama"
+)
+
+// maxOutput caps the bytes of tool output sent back to the model.
+const maxOutput = 32 * 1024
+
+// Tool is a function a model may call.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage // a JSON schema for the arguments
+	// SideEffects marks tools that change something, which only run once the
+	// user approves the call.
+	SideEffects bool
+	Run         func(ctx context.Context, args map[string]interface{}) (string, error)
+}
+
+// Registry holds the tools offered to a model. It implements ollama.Toolbox.
+type Registry struct {
+	tools map[string]Tool
+}
+
+func NewRegistry(tools ...Tool) *Registry {
+	r := &Registry{tools: make(map[string]Tool)}
+	for _, t := range tools {
+		r.Register(t)
+	}
+	return r
+}
+
+// Register adds a tool, replacing any with the same name.
+func (r *Registry) Register(t Tool) {
+	r.tools[t.Name] = t
+}
+
+// Names returns the names of the registered tools, sorted.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Tools describes the registered tools for a chat request.
+func (r *Registry) Tools() []ollama.Tool {
+	defs := make([]ollama.Tool, 0, len(r.tools))
+	for _, name := range r.Names() {
+		t := r.tools[name]
+		defs = append(defs, ollama.Tool{
+			Type: "function",
+			Function: ollama.ToolFunction{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			},
+		})
+	}
+	return defs
+}
+
+// NeedsApproval reports whether the named tool has side effects. Unknown
+// tools need no approval as calling them only returns an error.
+func (r *Registry) NeedsApproval(name string) bool {
+	return r.tools[name].SideEffects
+}
+
+// Call runs the tool the model asked for, truncating long output.
+func (r *Registry) Call(ctx context.Context, call ollama.ToolCall) (string, error) {
+	t, ok := r.tools[call.Function.Name]
+	if !ok {
+		return "", fmt.Errorf("no tool named %q", call.Function.Name)
+	}
+	out, err := t.Run(ctx, call.Function.Arguments)
+	if len(out) > maxOutput {
+		out = out[:maxOutput] + "\n[output truncated]"
+	}
+	return out, err
+}
+
+// stringArg returns the named string argument, which must be present.
+func stringArg(args map[string]interface{}, name string) (string, error) {
+	v, ok := args[name].(string)
+	if !ok || v == "" {
+		return "", fmt.Errorf("missing argument %q", name)
+	}
+	return v, nil
+}
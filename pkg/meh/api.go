@@ -0,0 +1,178 @@
+package meh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/cpcf/meh/internal/ollama"
+	"github.com/cpcf/meh/internal/openai"
+	"github.com/cpcf/meh/internal/tools"
+)
+
+// API is implemented by each backend provider. Chat, Regenerate and Prompt
+// send their events to results, which they close once the reply is complete
+// or ctx is cancelled; stream asks for the reply to arrive a token at a time
+// rather than whole.
+type API interface {
+	Verify() bool
+	Models() []string
+	SelectModel(model string)
+	History() []Message
+	Tree() Tree
+	SetTree(tree Tree)
+	Rewind() (Message, bool)
+	Attach(images ...string)
+	SetFormat(format json.RawMessage)
+	Chat(ctx context.Context, query string, results chan<- Event, stream bool)
+	Regenerate(ctx context.Context, results chan<- Event, stream bool)
+	Prompt(ctx context.Context, query string, results chan<- Event, stream bool)
+}
+
+// ToolUser is implemented by APIs that let the model call tools.
+type ToolUser interface {
+	SetTools(tools Toolbox)
+}
+
+// ContextManager is implemented by APIs that can cut long conversations down
+// to fit the model's context window.
+type ContextManager interface {
+	SetContextStrategy(s ContextStrategy)
+}
+
+// HTTPUser is implemented by APIs whose HTTP client can be replaced, to apply
+// a persona's HTTP settings.
+type HTTPUser interface {
+	SetHTTPClient(client *http.Client)
+}
+
+// Embedder is implemented by APIs that can embed text.
+type Embedder interface {
+	Embed(ctx context.Context, model string, input []string) ([][]float32, error)
+	SetEmbedOptions(opts EmbedOptions)
+}
+
+// ModelManager lists, describes, downloads and removes the models of a
+// server, see NewModelManager.
+type ModelManager interface {
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+	Running(ctx context.Context) ([]RunningModel, error)
+	Show(ctx context.Context, model string) (*ModelDescription, error)
+	// Pull downloads model, reporting its progress to progress, which it
+	// closes when done.
+	Pull(ctx context.Context, model string, progress chan<- PullProgress) error
+	Delete(ctx context.Context, model string) error
+	Copy(ctx context.Context, source, destination string) error
+}
+
+// NewModelManager returns a manager of the models on the persona's server,
+// which must be Ollama.
+func NewModelManager(p Persona) (ModelManager, error) {
+	if p.Provider != "" && p.Provider != DefaultProvider {
+		return nil, fmt.Errorf("persona %s uses %s, models can only be managed on an Ollama server", p.Name, p.Provider)
+	}
+	api := ollama.NewAPI(p.APIURL, p.Model, "")
+	if !p.HTTP.IsZero() {
+		client, err := NewHTTPClient(p.HTTP)
+		if err != nil {
+			return nil, err
+		}
+		api.SetHTTPClient(client)
+	}
+	return api, nil
+}
+
+// DefaultProvider is used by personas that don't name a provider.
+const DefaultProvider = "ollama"
+
+// Provider builds an API for a persona's backend.
+type Provider func(p Persona) API
+
+var providers = map[string]Provider{
+	"ollama": func(p Persona) API {
+		api := ollama.NewAPI(p.APIURL, p.Model, p.SystemPrompt)
+		api.SetOptions(p.Options)
+		return api
+	},
+	"openai": func(p Persona) API {
+		api := openai.NewAPI(p.APIURL, p.Model, p.SystemPrompt)
+		api.SetOptions(p.Options)
+		return api
+	},
+}
+
+// RegisterProvider makes a backend available to personas under name.
+func RegisterProvider(name string, provider Provider) {
+	providers[name] = provider
+}
+
+// ProviderNames returns the names of the registered providers, sorted.
+func ProviderNames() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewAPI returns an API for the persona's provider, configured with the
+// persona's settings.
+func NewAPI(p Persona) (API, error) {
+	name := p.Provider
+	if name == "" {
+		name = DefaultProvider
+	}
+	provider, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q", name)
+	}
+	format, err := p.ResponseFormat()
+	if err != nil {
+		return nil, err
+	}
+	api := provider(p)
+	api.SetFormat(format)
+	if !p.HTTP.IsZero() {
+		client, err := NewHTTPClient(p.HTTP)
+		if err != nil {
+			return nil, err
+		}
+		user, ok := api.(HTTPUser)
+		if !ok {
+			return nil, fmt.Errorf("provider %q does not support HTTP settings", name)
+		}
+		user.SetHTTPClient(client)
+	}
+	if len(p.Tools) > 0 {
+		box, err := tools.Builtin(p.Tools, p.Commands)
+		if err != nil {
+			return nil, err
+		}
+		user, ok := api.(ToolUser)
+		if !ok {
+			return nil, fmt.Errorf("provider %q does not support tools", name)
+		}
+		user.SetTools(box)
+	}
+	if p.Context != "" {
+		strategy, err := ollama.ParseContextStrategy(p.Context)
+		if err != nil {
+			return nil, err
+		}
+		manager, ok := api.(ContextManager)
+		if !ok {
+			return nil, fmt.Errorf("provider %q does not support context strategies", name)
+		}
+		manager.SetContextStrategy(strategy)
+	}
+	return api, nil
+}
+
+// NewHTTPClient returns an HTTP client configured with opts, which has no
+// overall timeout so replies can stream for as long as they take.
+func NewHTTPClient(opts HTTPOptions) (*http.Client, error) {
+	return ollama.NewHTTPClient(opts)
+}
@@ -0,0 +1,161 @@
+package meh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ErrNoConfig is returned by LoadConfig when there is no config file yet.
+var ErrNoConfig = errors.New("no config file")
+
+// Config is meh's config file: the personas, which of them is the default,
+// and the prompt templates.
+type Config struct {
+	DefaultPersona string     `yaml:"default_persona"`
+	Personas       []Persona  `yaml:"personas"`
+	Templates      []Template `yaml:"templates,omitempty"`
+}
+
+var confdir = "/.config/.meh"
+
+// ConfigDir returns the directory holding meh's config and saved data.
+func ConfigDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return home + confdir, nil
+}
+
+// ConfigPath returns the path of the config file.
+func ConfigPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yml"), nil
+}
+
+// LoadConfig reads the config file from the user's home directory.
+func LoadConfig() (*Config, error) {
+	configPath, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoConfig
+	}
+	if err != nil {
+		return nil, err
+	}
+	var conf Config
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return nil, fmt.Errorf("%s: %w", configPath, err)
+	}
+	return &conf, nil
+}
+
+// SaveConfig writes conf to the config file.
+func SaveConfig(conf *Config) error {
+	configPath, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath), os.ModePerm); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(configPath, data, 0644)
+}
+
+// FindPersona searches for a persona by name.
+func (c *Config) FindPersona(name string) (Persona, bool) {
+	for _, persona := range c.Personas {
+		if persona.Name == name {
+			return persona, true
+		}
+	}
+	return Persona{}, false
+}
+
+// SelectPersona returns the persona called name or, if there is none, the
+// default persona. It reports false if neither exists.
+func (c *Config) SelectPersona(name string) (Persona, bool) {
+	if name != "" {
+		if persona, ok := c.FindPersona(name); ok {
+			return persona, true
+		}
+	}
+	return c.FindPersona(c.DefaultPersona)
+}
+
+// AddPersona adds persona, making it the default if setDefault is set, and
+// saves the config.
+func (c *Config) AddPersona(persona Persona, setDefault bool) error {
+	c.Personas = append(c.Personas, persona)
+	if setDefault {
+		c.DefaultPersona = persona.Name
+	}
+	return SaveConfig(c)
+}
+
+// UpdatePersona replaces the persona called name, which may be renamed, and
+// saves the config. setDefault makes it the default persona, otherwise it
+// stops being the default.
+func (c *Config) UpdatePersona(name string, persona Persona, setDefault bool) error {
+	i := c.personaIndex(name)
+	if i < 0 {
+		return fmt.Errorf("no persona named %q", name)
+	}
+	if persona.Name != name && c.personaIndex(persona.Name) >= 0 {
+		return fmt.Errorf("a persona named %q already exists", persona.Name)
+	}
+	c.Personas[i] = persona
+	switch {
+	case setDefault:
+		c.DefaultPersona = persona.Name
+	case c.DefaultPersona == name:
+		c.DefaultPersona = ""
+	}
+	return SaveConfig(c)
+}
+
+// RemovePersona deletes the persona called name and saves the config.
+func (c *Config) RemovePersona(name string) error {
+	i := c.personaIndex(name)
+	if i < 0 {
+		return fmt.Errorf("no persona named %q", name)
+	}
+	c.Personas = append(c.Personas[:i], c.Personas[i+1:]...)
+	if c.DefaultPersona == name {
+		c.DefaultPersona = ""
+	}
+	return SaveConfig(c)
+}
+
+// SetDefaultPersona makes the persona called name the default and saves the
+// config.
+func (c *Config) SetDefaultPersona(name string) error {
+	if c.personaIndex(name) < 0 {
+		return fmt.Errorf("no persona named %q", name)
+	}
+	c.DefaultPersona = name
+	return SaveConfig(c)
+}
+
+func (c *Config) personaIndex(name string) int {
+	for i, persona := range c.Personas {
+		if persona.Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,224 @@
+// Package meh chats with local and hosted language models through the
+// personas of meh's config file, or personas built in code.
+//
+//	conf, err := meh.LoadConfig()
+//	if err != nil {
+//		return err
+//	}
+//	persona, ok := conf.SelectPersona("")
+//	if !ok {
+//		return errors.New("no default persona")
+//	}
+//	client, err := meh.NewClient(persona)
+//	if err != nil {
+//		return err
+//	}
+//	stream := client.Chat(ctx, "Why is the sky blue?")
+//	for ev := range stream.Events() {
+//		if ev.Kind == meh.TokenEvent {
+//			fmt.Print(ev.Content)
+//		}
+//	}
+//	if err := stream.Err(); err != nil {
+//		return err
+//	}
+//
+// Replies can also be waited for whole with Stream.Text.
+package meh
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"strings"
+)
+
+// Client chats with the model of a persona. A Client remembers the
+// conversation held through Chat, and must not be used by several goroutines
+// at once.
+type Client struct {
+	persona Persona
+	api     API
+}
+
+// NewClient returns a client for the persona's provider, configured with the
+// persona's settings.
+func NewClient(p Persona) (*Client, error) {
+	api, err := NewAPI(p)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{persona: p, api: api}, nil
+}
+
+// Persona returns the persona the client was made for.
+func (c *Client) Persona() Persona {
+	return c.persona
+}
+
+// API returns the provider's API, for what the client doesn't cover.
+func (c *Client) API() API {
+	return c.api
+}
+
+// Chat sends message, with any images attached, as the next message of the
+// conversation and streams the reply, which is added to the conversation once
+// it is complete.
+func (c *Client) Chat(ctx context.Context, message string, images ...string) *Stream {
+	c.api.Attach(images...)
+	return newStream(ctx, func(ctx context.Context, results chan<- Event) {
+		c.api.Chat(ctx, message, results, true)
+	})
+}
+
+// Regenerate streams a new reply to the last message of the conversation, as
+// another branch of it.
+func (c *Client) Regenerate(ctx context.Context) *Stream {
+	return newStream(ctx, func(ctx context.Context, results chan<- Event) {
+		c.api.Regenerate(ctx, results, true)
+	})
+}
+
+// Generate streams the reply to a single prompt, with any images attached,
+// outside of the conversation.
+func (c *Client) Generate(ctx context.Context, prompt string, images ...string) *Stream {
+	c.api.Attach(images...)
+	return newStream(ctx, func(ctx context.Context, results chan<- Event) {
+		c.api.Prompt(ctx, prompt, results, true)
+	})
+}
+
+// Embed returns the embedding of each of input, made by model or, if it is
+// empty, by the persona's model.
+func (c *Client) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	e, ok := c.api.(Embedder)
+	if !ok {
+		return nil, errors.New("provider does not support embeddings")
+	}
+	return e.Embed(ctx, model, input)
+}
+
+// SetEmbedOptions sets how inputs are batched and truncated by Embed.
+func (c *Client) SetEmbedOptions(opts EmbedOptions) error {
+	e, ok := c.api.(Embedder)
+	if !ok {
+		return errors.New("provider does not support embeddings")
+	}
+	e.SetEmbedOptions(opts)
+	return nil
+}
+
+// Models returns the models the provider serves.
+func (c *Client) Models() []string {
+	return c.api.Models()
+}
+
+// SelectModel switches to model for the following replies.
+func (c *Client) SelectModel(model string) {
+	c.api.SelectModel(model)
+}
+
+// History returns the messages of the conversation's current branch.
+func (c *Client) History() []Message {
+	return c.api.History()
+}
+
+// Tree returns the conversation with all of its branches.
+func (c *Client) Tree() Tree {
+	return c.api.Tree()
+}
+
+// SetTree replaces the conversation, e.g. to resume a saved one.
+func (c *Client) SetTree(tree Tree) {
+	c.api.SetTree(tree)
+}
+
+// Stream is a reply as it is generated. Its events are read once, with
+// Events or Text.
+type Stream struct {
+	events chan Event
+	cancel context.CancelFunc
+	done   bool
+	text   strings.Builder
+	stats  *Stats
+	err    error
+}
+
+// newStream runs send, which must close results once it is done, with a
+// context that is cancelled if the stream is abandoned.
+func newStream(ctx context.Context, send func(context.Context, chan<- Event)) *Stream {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Stream{events: make(chan Event), cancel: cancel}
+	go send(ctx, s.events)
+	return s
+}
+
+// Events returns an iterator over the reply's events. A ToolCallEvent whose
+// Approve channel is set waits for the tool call to be allowed or declined
+// through it. Stopping the iteration early stops the reply.
+func (s *Stream) Events() iter.Seq[Event] {
+	return func(yield func(Event) bool) {
+		if s.done {
+			return
+		}
+		s.done = true
+		defer s.cancel()
+		for ev := range s.events {
+			s.record(ev)
+			if !yield(ev) {
+				s.cancel()
+				s.drain()
+				return
+			}
+		}
+	}
+}
+
+// record keeps what ev adds to the reply.
+func (s *Stream) record(ev Event) {
+	switch ev.Kind {
+	case TokenEvent:
+		s.text.WriteString(ev.Content)
+	case DoneEvent:
+		stats := ev.Stats
+		s.stats = &stats
+	case ErrorEvent:
+		s.err = ev.Err
+	}
+}
+
+// drain reads the rest of the events, declining tool calls, so the API can
+// finish.
+func (s *Stream) drain() {
+	for ev := range s.events {
+		s.record(ev)
+		if ev.Approve != nil {
+			ev.Approve <- false
+		}
+	}
+}
+
+// Text waits for the reply to be complete, declining any tool calls that need
+// approval, and returns its text and the error the API reported, if any.
+func (s *Stream) Text() (string, error) {
+	if !s.done {
+		s.done = true
+		s.drain()
+		s.cancel()
+	}
+	return s.text.String(), s.err
+}
+
+// Stats returns the token counts and timings of the reply, once it is
+// complete. It reports false if the reply was stopped or failed.
+func (s *Stream) Stats() (Stats, bool) {
+	if s.stats == nil {
+		return Stats{}, false
+	}
+	return *s.stats, true
+}
+
+// Err returns the error the API reported, once the events have been read.
+func (s *Stream) Err() error {
+	return s.err
+}
@@ -0,0 +1,114 @@
+package meh
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/cpcf/meh/internal/ollama"
+)
+
+// ollamaServer answers /chat by streaming tokens, one line each, then a final
+// response with stats. If stall is set it stops after the first token until
+// the client goes away, then closes stall.
+func ollamaServer(t *testing.T, tokens []string, stall chan<- struct{}) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat" {
+			http.NotFound(w, r)
+			return
+		}
+		enc := json.NewEncoder(w)
+		for _, token := range tokens {
+			enc.Encode(ollama.Response{Message: &Message{Role: "assistant", Content: token}})
+			w.(http.Flusher).Flush()
+			if stall != nil {
+				<-r.Context().Done()
+				close(stall)
+				return
+			}
+		}
+		enc.Encode(ollama.Response{Message: &Message{Role: "assistant"}, Done: true, EvalCount: len(tokens)})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestClient(t *testing.T, url string) *Client {
+	t.Helper()
+	client, err := NewClient(Persona{Name: "test", APIURL: url, Model: "llama3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestStreamEvents(t *testing.T) {
+	srv := ollamaServer(t, []string{"The ", "sky ", "scatters."}, nil)
+	client := newTestClient(t, srv.URL)
+
+	stream := client.Chat(context.Background(), "Why is the sky blue?")
+	var tokens []string
+	var kinds []EventKind
+	for ev := range stream.Events() {
+		kinds = append(kinds, ev.Kind)
+		if ev.Kind == TokenEvent {
+			tokens = append(tokens, ev.Content)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"The ", "sky ", "scatters."}; !slices.Equal(tokens, want) {
+		t.Errorf("tokens = %q, want %q", tokens, want)
+	}
+	if kinds[len(kinds)-1] != DoneEvent {
+		t.Errorf("last event = %v, want DoneEvent", kinds[len(kinds)-1])
+	}
+	if stats, ok := stream.Stats(); !ok || stats.EvalCount != 3 {
+		t.Errorf("Stats() = %+v, %v, want 3 tokens", stats, ok)
+	}
+	// The events are read once.
+	for range stream.Events() {
+		t.Fatal("Events() yielded after the reply was read")
+	}
+	if text, err := stream.Text(); text != "The sky scatters." || err != nil {
+		t.Errorf("Text() = %q, %v, want the whole reply", text, err)
+	}
+
+	h := client.History()
+	if len(h) != 2 || h[0].Content != "Why is the sky blue?" || h[1].Content != "The sky scatters." {
+		t.Errorf("History() = %v, want the question and reply", h)
+	}
+}
+
+func TestStreamEventsStopped(t *testing.T) {
+	stopped := make(chan struct{})
+	srv := ollamaServer(t, []string{"1", "2"}, stopped)
+	client := newTestClient(t, srv.URL)
+
+	stream := client.Chat(context.Background(), "Count.")
+	for range stream.Events() {
+		break
+	}
+	// Breaking out of the loop stops the request.
+	<-stopped
+	if _, ok := stream.Stats(); ok {
+		t.Error("Stats() of a stopped reply reported success")
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"model not found"}`, http.StatusNotFound)
+	}))
+	defer srv.Close()
+	client := newTestClient(t, srv.URL)
+
+	text, err := client.Chat(context.Background(), "hi").Text()
+	if err == nil || text != "" {
+		t.Errorf("Text() = %q, %v, want an error", text, err)
+	}
+}
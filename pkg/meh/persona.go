@@ -0,0 +1,126 @@
+package meh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/cpcf/meh/internal/ollama"
+	"github.com/cpcf/meh/internal/schema"
+)
+
+// Persona represents a user-defined persona that overrides API/model settings and may include a system prompt.
+type Persona struct {
+	Name         string      `yaml:"name"`
+	Provider     string      `yaml:"provider,omitempty"` // backend API, "ollama" if empty
+	APIURL       string      `yaml:"api_url"`
+	Model        string      `yaml:"model"`
+	SystemPrompt string      `yaml:"system_prompt,omitempty"`
+	Options      Options     `yaml:"options,omitempty"`
+	Format       string      `yaml:"format,omitempty"`   // "json" to constrain replies to JSON
+	Schema       string      `yaml:"schema,omitempty"`   // path to a JSON schema replies must match
+	Tools        []string    `yaml:"tools,omitempty"`    // built-in tools the model may call
+	Commands     []string    `yaml:"commands,omitempty"` // programs the run_command tool may run
+	Context      string      `yaml:"context,omitempty"`  // how long chats are fit into the context window
+	HTTP         HTTPOptions `yaml:"http,omitempty"`     // timeouts, retries, headers, TLS and proxy
+}
+
+func (r Persona) String() string {
+	return fmt.Sprintf("Persona{Name: %s, Provider: %s, APIURL: %s, Model: %s, SystemPrompt: %s, Options: %v}", r.Name, r.Provider, r.APIURL, r.Model, r.SystemPrompt, r.Options)
+}
+
+// ResponseFormat returns the format replies are constrained to: the JSON
+// string "json", the contents of the persona's schema file, or nil for free
+// text. Relative schema paths are resolved against the config directory.
+func (r Persona) ResponseFormat() (json.RawMessage, error) {
+	switch {
+	case r.Schema != "":
+		path := r.Schema
+		if !filepath.IsAbs(path) {
+			dir, err := ConfigDir()
+			if err != nil {
+				return nil, err
+			}
+			path = filepath.Join(dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading schema: %w", err)
+		}
+		if err := schema.Check(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Schema, err)
+		}
+		return data, nil
+	case r.Format == "json":
+		return json.RawMessage(`"json"`), nil
+	case r.Format != "":
+		return nil, fmt.Errorf("unknown format %q, expected json", r.Format)
+	}
+	return nil, nil
+}
+
+// IsZero reports whether no persona has been set.
+func (r Persona) IsZero() bool {
+	return r.Name == "" && r.Provider == "" && r.APIURL == "" && r.Model == "" && r.SystemPrompt == "" &&
+		len(r.Options) == 0 && r.Format == "" && r.Schema == "" && len(r.Tools) == 0 && len(r.Commands) == 0 && r.Context == "" && r.HTTP.IsZero()
+}
+
+// ContextSize returns the size in tokens of the model's context window: the
+// num_ctx option, Ollama's default if it is unset, or 0 if it isn't known.
+func (r Persona) ContextSize() int {
+	if n := r.Options.Int("num_ctx"); n > 0 {
+		return n
+	}
+	if r.Provider == "" || r.Provider == "ollama" {
+		return ollama.DefaultNumCtx
+	}
+	return 0
+}
+
+// ValidatePersona applies the checks of the persona form: the name must be
+// new, or original when editing a persona, the API must answer at the URL and
+// serve the model.
+func (c *Config) ValidatePersona(p Persona, original string) error {
+	if err := c.ValidatePersonaName(p.Name, original); err != nil {
+		return err
+	}
+	if err := ValidateAPIURL(p); err != nil {
+		return err
+	}
+	api, err := NewAPI(p)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(api.Models(), p.Model) {
+		return fmt.Errorf("model %q not found at %s", p.Model, p.APIURL)
+	}
+	return nil
+}
+
+// ValidatePersonaName checks that name is not empty and not taken by another
+// persona than original.
+func (c *Config) ValidatePersonaName(name, original string) error {
+	if _, ok := c.FindPersona(name); ok && name != original {
+		return errors.New("That persona already exists.")
+	}
+	if name == "" {
+		return errors.New("Name cannot be empty")
+	}
+	return nil
+}
+
+// ValidateAPIURL checks that the persona's provider answers at its API URL,
+// reached with its HTTP settings.
+func ValidateAPIURL(p Persona) error {
+	api, err := NewAPI(Persona{Provider: p.Provider, APIURL: p.APIURL, HTTP: p.HTTP})
+	if err != nil {
+		return err
+	}
+	if !api.Verify() {
+		return errors.New("Could not connect to API")
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package meh
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Template is a reusable prompt. Its body is a text/template filled in with
+// {{.Input}}, the input of the query, and named variables such as {{.lang}}.
+type Template struct {
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description,omitempty"`
+	Persona     string            `yaml:"persona,omitempty"` // used unless another is selected
+	Body        string            `yaml:"body"`
+	Defaults    map[string]string `yaml:"defaults,omitempty"` // values of variables that aren't given
+}
+
+// inputField is the template field holding the query's input.
+const inputField = "Input"
+
+// FindTemplate searches for a template by name.
+func (c *Config) FindTemplate(name string) (Template, bool) {
+	for _, t := range c.Templates {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Template{}, false
+}
+
+// TemplateNames returns the names of the templates in the config, sorted.
+func (c *Config) TemplateNames() []string {
+	names := make([]string, len(c.Templates))
+	for i, t := range c.Templates {
+		names[i] = t.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parse parses the template's body. Executing it fails on a variable that
+// has no value.
+func (t Template) parse() (*template.Template, error) {
+	tmpl, err := template.New(t.Name).Option("missingkey=error").Parse(t.Body)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", t.Name, err)
+	}
+	return tmpl, nil
+}
+
+// Variables returns the names of the variables used in the template's body,
+// other than Input, in the order they first appear.
+func (t Template) Variables() ([]string, error) {
+	tmpl, err := t.parse()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	seen := map[string]bool{inputField: true}
+	walkFields(tmpl.Tree.Root, func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	})
+	return names, nil
+}
+
+// UsesInput reports whether the template's body includes the query's input.
+func (t Template) UsesInput() bool {
+	tmpl, err := t.parse()
+	if err != nil {
+		return false
+	}
+	uses := false
+	walkFields(tmpl.Tree.Root, func(name string) {
+		uses = uses || name == inputField
+	})
+	return uses
+}
+
+// Missing returns the variables of the template that have neither a value
+// in vars nor a default.
+func (t Template) Missing(vars map[string]string) ([]string, error) {
+	names, err := t.Variables()
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, name := range names {
+		_, given := vars[name]
+		_, hasDefault := t.Defaults[name]
+		if !given && !hasDefault {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+// Execute fills in the template with input and the variables in vars, which
+// take precedence over the template's defaults.
+func (t Template) Execute(input string, vars map[string]string) (string, error) {
+	tmpl, err := t.parse()
+	if err != nil {
+		return "", err
+	}
+	data := map[string]string{}
+	for k, v := range t.Defaults {
+		data[k] = v
+	}
+	for k, v := range vars {
+		data[k] = v
+	}
+	data[inputField] = input
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("template %s: %w", t.Name, err)
+	}
+	return b.String(), nil
+}
+
+// walkFields calls fn with the name of each top-level field, such as .lang,
+// used in the template tree under node. Fields inside range and with blocks
+// refer to something else and are skipped.
+func walkFields(node parse.Node, fn func(name string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkFields(child, fn)
+		}
+	case *parse.ActionNode:
+		walkFields(n.Pipe, fn)
+	case *parse.IfNode:
+		walkFields(n.Pipe, fn)
+		walkFields(n.List, fn)
+		walkFields(n.ElseList, fn)
+	case *parse.RangeNode:
+		walkFields(n.Pipe, fn)
+		walkFields(n.ElseList, fn)
+	case *parse.WithNode:
+		walkFields(n.Pipe, fn)
+		walkFields(n.ElseList, fn)
+	case *parse.TemplateNode:
+		walkFields(n.Pipe, fn)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkFields(cmd, fn)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walkFields(arg, fn)
+		}
+	case *parse.FieldNode:
+		fn(n.Ident[0])
+	}
+}
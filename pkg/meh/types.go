@@ -0,0 +1,101 @@
+package meh
+
+import "github.com/cpcf/meh/internal/ollama"
+
+// The types of conversations, generation options and replies, shared by
+// every provider.
+type (
+	// Message is a message of a conversation: from the "system", the "user",
+	// the "assistant" or a "tool".
+	Message = ollama.Message
+	// Options are generation options such as temperature and num_ctx, named
+	// as Ollama names them.
+	Options = ollama.Options
+	// Tree is a conversation with every branch it has taken.
+	Tree = ollama.Tree
+	// Event is an item of a reply as it streams in.
+	Event     = ollama.Event
+	EventKind = ollama.EventKind
+	// Stats holds the token counts and timings of a complete reply.
+	Stats = ollama.Stats
+	// ToolCall is a model's call of a tool.
+	ToolCall = ollama.ToolCall
+	// Toolbox offers tools to a model.
+	Toolbox = ollama.Toolbox
+	// ContextStrategy decides how conversations that outgrow the context
+	// window are cut down.
+	ContextStrategy = ollama.ContextStrategy
+	// EmbedOptions controls how inputs are batched and truncated for
+	// embedding.
+	EmbedOptions = ollama.EmbedOptions
+	// HTTPOptions configures how requests reach an API: timeouts, retries,
+	// headers, TLS and a proxy.
+	HTTPOptions = ollama.HTTPOptions
+
+	// ModelInfo is a model stored on the server.
+	ModelInfo = ollama.ModelInfo
+	// ModelDetails describes a model's format, family and size.
+	ModelDetails = ollama.ModelDetails
+	// RunningModel is a model loaded in memory.
+	RunningModel = ollama.RunningModel
+	// ModelDescription is what the server tells of a model: its details,
+	// parameters, license and capabilities.
+	ModelDescription = ollama.ShowResponse
+	// PullProgress reports the state of a model download.
+	PullProgress = ollama.PullProgress
+)
+
+// The kinds of Event.
+const (
+	TokenEvent      = ollama.TokenEvent
+	DoneEvent       = ollama.DoneEvent
+	ErrorEvent      = ollama.ErrorEvent
+	ToolCallEvent   = ollama.ToolCallEvent
+	ToolResultEvent = ollama.ToolResultEvent
+)
+
+// The context strategies, see ContextStrategies.
+const (
+	ContextFull      = ollama.ContextFull
+	ContextWindow    = ollama.ContextWindow
+	ContextPin       = ollama.ContextPin
+	ContextSummarize = ollama.ContextSummarize
+)
+
+// DefaultEmbedBatch is how many inputs are embedded per request unless
+// EmbedOptions say otherwise.
+const DefaultEmbedBatch = ollama.DefaultEmbedBatch
+
+// ContextStrategies returns the names of the context strategies.
+func ContextStrategies() []string {
+	return ollama.ContextStrategies()
+}
+
+// OptionNames returns the names of the generation options ParseOption
+// understands.
+func OptionNames() []string {
+	return ollama.OptionNames()
+}
+
+// ParseOption converts the string form of a named generation option to the
+// type it takes. Stop sequences are given as a comma separated list, and an
+// empty value parses to nil, leaving the option unset.
+func ParseOption(name, value string) (interface{}, error) {
+	return ollama.ParseOption(name, value)
+}
+
+// EstimateTokens guesses how many tokens m takes up in the context window.
+func EstimateTokens(m Message) int {
+	return ollama.EstimateTokens(m)
+}
+
+// NewTree returns a conversation holding messages, one after the other.
+func NewTree(messages []Message) Tree {
+	return ollama.NewTree(messages)
+}
+
+// LoadImage reads a PNG or JPEG file, base64 encoded for attaching to a
+// message.
+func LoadImage(path string) (string, error) {
+	return ollama.LoadImage(path)
+}